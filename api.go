@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	apiPrefix         = "/api/v1"
+	maxUpdateBodySize = 1 << 20
+
+	updateApplied   = "applied"
+	updateUnchanged = "unchanged"
+	updateStale     = "stale"
+	updateRejected  = "rejected"
+	updateSkipped   = "skipped"
+)
+
+// UpdateResult is the result of a single update pushed through the api
+type UpdateResult struct {
+	ID     string `json:"id"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// UpdateResults is the response of the updates api
+type UpdateResults struct {
+	Results []UpdateResult `json:"results"`
+}
+
+// StatusHistory is the response of the history api
+type StatusHistory struct {
+	ID          string       `json:"id"`
+	Since       time.Time    `json:"since"`
+	Until       time.Time    `json:"until"`
+	Transitions []Transition `json:"transitions"`
+}
+
+// APIError is the response of the api when the request could not be handled
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// routeAPI adds the versioned api routes
+func (m *Monitor) routeAPI(router *mux.Router) {
+	api := router.PathPrefix(apiPrefix).Subrouter()
+	api.Handle("/updates", m.basicAuth(m.postUpdatesHandler(), false)).Methods(http.MethodPost)
+	api.Handle("/status/{id}/history", m.basicAuth(m.getHistoryHandler(), false)).Methods(http.MethodGet)
+	api.Handle("/status/{id}/uptime", m.basicAuth(m.getUptimeHandler(), false)).Methods(http.MethodGet)
+	api.Handle("/reload", m.basicAuth(m.postReloadHandler(), false)).Methods(http.MethodPost)
+}
+
+// postUpdatesHandler applies a batch of updates. All updates are validated first so either all
+// of them are applied or none of them are. Updates older than the status, or than an earlier update
+// of the same status in the batch, are found while validating and left out without failing the batch
+func (m *Monitor) postUpdatesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rawUpdates []json.RawMessage
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateBodySize))
+		err := decoder.Decode(&rawUpdates)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIError{Error: "Body must be a json array of updates: " + err.Error()})
+			return
+		}
+
+		// hold the lock for the whole batch so no other update is applied in between
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		updates, results, ok := m.validateUpdates(rawUpdates)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, UpdateResults{Results: results})
+			return
+		}
+
+		for i, su := range updates {
+			if results[i].Result == updateStale {
+				continue
+			}
+			su.Source = apiSource
+			changed, err := m.applyUpdate(su)
+			switch {
+			case err == StaleUpdate:
+				results[i].Result = updateStale
+			case err != nil && changed:
+				// the status was changed but clients were not sent it, they get it with their next snapshot
+				results[i].Result = updateApplied
+				results[i].Error = "Could not send to the dashboard: " + err.Error()
+			case err != nil:
+				results[i].Result = updateRejected
+				results[i].Error = err.Error()
+			case changed:
+				results[i].Result = updateApplied
+			default:
+				results[i].Result = updateUnchanged
+			}
+		}
+		writeJSON(w, http.StatusOK, UpdateResults{Results: results})
+	})
+}
+
+// validateUpdates parses and checks every update and returns a result for each along with whether all of them are valid.
+// Stale updates already have their result. Must be called with the lock held
+func (m *Monitor) validateUpdates(rawUpdates []json.RawMessage) ([]StatusUpdate, []UpdateResult, bool) {
+	updates := make([]StatusUpdate, len(rawUpdates))
+	results := make([]UpdateResult, len(rawUpdates))
+	updated := map[string]time.Time{} // key: status id, when it will have been last updated by the updates before
+	ok := true
+	for i, raw := range rawUpdates {
+		su, err := m.validateUpdate(raw)
+		updates[i] = su
+		results[i] = UpdateResult{ID: su.ID, Result: updateSkipped}
+		if err != nil {
+			results[i].Result = updateRejected
+			results[i].Error = err.Error()
+			ok = false
+			continue
+		}
+		last, seen := updated[su.ID]
+		if !seen {
+			s, _ := FindStatus(su.ID, m.statuses)
+			last = s.updated
+		}
+		if su.Timestamp != nil && su.Timestamp.Before(last) {
+			results[i].Result = updateStale
+			continue
+		}
+		updated[su.ID] = time.Now()
+		if su.Timestamp != nil {
+			updated[su.ID] = *su.Timestamp
+		}
+	}
+	return updates, results, ok
+}
+
+func (m *Monitor) validateUpdate(raw json.RawMessage) (StatusUpdate, error) {
+	var su StatusUpdate
+	err := json.Unmarshal(raw, &su)
+	if err != nil {
+		// still try to get the id so the result can be matched to the update
+		var id struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(raw, &id)
+		return StatusUpdate{ID: id.ID}, err
+	}
+	if su.ID == "" {
+		return su, fmt.Errorf("Missing id")
+	}
+	if !su.Status.IsValid() {
+		return su, InvalidStatusError{Value: string(su.Status)}
+	}
+	_, err = FindStatus(su.ID, m.statuses)
+	return su, err
+}
+
+// getHistoryHandler returns the transitions of a status between the optional since and until RFC3339 times
+func (m *Monitor) getHistoryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		since, until, err := parseTimeRange(r, time.Time{}, time.Now())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIError{Error: err.Error()})
+			return
+		}
+
+		m.lock.RLock()
+		_, err = FindStatus(id, m.statuses)
+		m.lock.RUnlock()
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, APIError{Error: err.Error()})
+			return
+		}
+
+		transitions, err := m.history.Query(id, since, until)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, APIError{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, StatusHistory{
+			ID:          id,
+			Since:       since,
+			Until:       until,
+			Transitions: transitions,
+		})
+	})
+}
+
+// getUptimeHandler returns the uptime of a status between the optional since and until RFC3339 times.
+// Instead of since, a window duration like 720h before until can be given. Defaults to the last 30 days
+func (m *Monitor) getUptimeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		until := time.Now()
+		window := defaultUptimeWindow
+		var err error
+		if value := r.URL.Query().Get("window"); value != "" {
+			window, err = time.ParseDuration(value)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, APIError{Error: "Invalid window: " + err.Error()})
+				return
+			}
+		}
+		if value := r.URL.Query().Get("until"); value != "" {
+			until, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, APIError{Error: "Invalid until, must be RFC3339: " + err.Error()})
+				return
+			}
+		}
+		since, until, err := parseTimeRange(r, until.Add(-window), until)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIError{Error: err.Error()})
+			return
+		}
+
+		uptime, err := m.Uptime(id, since, until)
+		switch {
+		case err == StatusNotFound:
+			writeJSON(w, http.StatusNotFound, APIError{Error: err.Error()})
+		case err == EmptyUptimeWindow:
+			writeJSON(w, http.StatusBadRequest, APIError{Error: err.Error()})
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, APIError{Error: err.Error()})
+		default:
+			writeJSON(w, http.StatusOK, uptime)
+		}
+	})
+}
+
+// postReloadHandler reloads the config file and returns what changed. An invalid config is not applied
+func (m *Monitor) postReloadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.reloader == nil {
+			writeJSON(w, http.StatusNotFound, APIError{Error: "Reloading the config is not enabled"})
+			return
+		}
+		changes, err := m.reloader.Reload()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIError{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, changes)
+	})
+}
+
+// parseTimeRange parses the since and until RFC3339 query parameters using the defaults if missing
+func parseTimeRange(r *http.Request, defaultSince, defaultUntil time.Time) (time.Time, time.Time, error) {
+	since, until := defaultSince, defaultUntil
+	var err error
+	if value := r.URL.Query().Get("since"); value != "" {
+		since, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return since, until, fmt.Errorf("Invalid since, must be RFC3339: %s", err.Error())
+		}
+	}
+	if value := r.URL.Query().Get("until"); value != "" {
+		until, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return since, until, fmt.Errorf("Invalid until, must be RFC3339: %s", err.Error())
+		}
+	}
+	if until.Before(since) {
+		return since, until, fmt.Errorf("until must not be before since")
+	}
+	return since, until, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		logger.Error("Could not marshal response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(payload)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API", func() {
+	var router *mux.Router
+	var service1, service2 *Status
+
+	BeforeEach(func() {
+		service1 = &Status{ID: "service1", Status: StatusGood}
+		service2 = &Status{ID: "service2", Status: StatusGood}
+		router = mux.NewRouter()
+		NewMonitor(&MonitorConfig{
+			Router:   router,
+			Username: "admin",
+			Password: "password",
+			Statuses: []*Status{{
+				ID:       "prod",
+				Children: []*Status{service1, service2},
+			}},
+		})
+	})
+
+	postUpdates := func(body string) (*httptest.ResponseRecorder, UpdateResults) {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/updates", bytes.NewBufferString(body))
+		r.SetBasicAuth("admin", "password")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var results UpdateResults
+		json.Unmarshal(w.Body.Bytes(), &results)
+		return w, results
+	}
+
+	Describe("Given a batch of updates", func() {
+		Context("When all updates are valid", func() {
+			It("Then they should all be applied", func() {
+				w, results := postUpdates(`[
+					{"id": "prod#service1", "status": "bad", "message": "500s", "subText": "eu"},
+					{"id": "prod#service2", "status": "good"}
+				]`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(results.Results).To(Equal([]UpdateResult{
+					{ID: "prod#service1", Result: updateApplied},
+					{ID: "prod#service2", Result: updateUnchanged},
+				}))
+				Expect(service1.Status).To(Equal(StatusBad))
+				Expect(service1.Message).To(Equal("500s"))
+				Expect(service1.SubText).To(Equal("eu"))
+			})
+		})
+		Context("When any update is invalid", func() {
+			It("Then none of them should be applied", func() {
+				w, results := postUpdates(`[
+					{"id": "prod#service1", "status": "bad"},
+					{"id": "prod#service2", "status": "banana"},
+					{"id": "prod#service3", "status": "bad"}
+				]`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(results.Results[0].Result).To(Equal(updateSkipped))
+				Expect(results.Results[1].Result).To(Equal(updateRejected))
+				Expect(results.Results[1].Error).To(ContainSubstring("banana"))
+				Expect(results.Results[2].Result).To(Equal(updateRejected))
+				Expect(service1.Status).To(Equal(StatusGood))
+			})
+		})
+		Context("When an update is older than the last update", func() {
+			It("Then it should be ignored", func() {
+				_, results := postUpdates(`[{"id": "prod#service1", "status": "bad", "timestamp": "2018-04-10T10:00:00Z"}]`)
+				Expect(results.Results[0].Result).To(Equal(updateApplied))
+
+				_, results = postUpdates(`[{"id": "prod#service1", "status": "good", "timestamp": "2018-04-10T09:00:00Z"}]`)
+				Expect(results.Results[0].Result).To(Equal(updateStale))
+				Expect(service1.Status).To(Equal(StatusBad))
+			})
+		})
+		Context("When an update is older than an earlier update in the batch", func() {
+			It("Then only it should be left out", func() {
+				w, results := postUpdates(`[
+					{"id": "prod#service1", "status": "bad", "timestamp": "2018-04-10T10:00:00Z"},
+					{"id": "prod#service1", "status": "good", "timestamp": "2018-04-10T09:00:00Z"},
+					{"id": "prod#service2", "status": "degraded", "timestamp": "2018-04-10T09:00:00Z"}
+				]`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(results.Results).To(Equal([]UpdateResult{
+					{ID: "prod#service1", Result: updateApplied},
+					{ID: "prod#service1", Result: updateStale},
+					{ID: "prod#service2", Result: updateApplied},
+				}))
+				Expect(service1.Status).To(Equal(StatusBad))
+				Expect(service2.Status).To(Equal(StatusDegraded))
+			})
+		})
+		Context("When the body is not a json array", func() {
+			It("Then it should be a bad request", func() {
+				w, _ := postUpdates(`{"id": "prod#service1"}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+})
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	historyBucket  = []byte("history")
+	minHistoryTime = time.Unix(0, 0)
+	maxHistoryTime = time.Unix(0, math.MaxInt64)
+)
+
+// BoltHistory keeps the transitions of every status in a bolt database file so they survive restarts.
+// Each status has its own bucket with transitions keyed by timestamp so a time range is a cursor seek
+type BoltHistory struct {
+	db *bolt.DB
+}
+
+// NewBoltHistory opens or creates the bolt database file
+func NewBoltHistory(path string) (*BoltHistory, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltHistory{db: db}, nil
+}
+
+// Record stores a transition
+func (bh *BoltHistory) Record(t Transition) error {
+	value, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return bh.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(t.ID))
+		if err != nil {
+			return err
+		}
+		// the sequence keeps transitions with the same timestamp from overwriting each other
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		return bucket.Put(historyKey(t.Timestamp, seq), value)
+	})
+}
+
+// Query returns the transitions of a status between since and until
+func (bh *BoltHistory) Query(id string, since, until time.Time) ([]Transition, error) {
+	transitions := []Transition{}
+	err := bh.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket).Bucket([]byte(id))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		max := historyKey(until, ^uint64(0))
+		for k, v := c.Seek(historyKey(since, 0)); k != nil && bytes.Compare(k, max) <= 0; k, v = c.Next() {
+			var t Transition
+			err := json.Unmarshal(v, &t)
+			if err != nil {
+				return err
+			}
+			transitions = append(transitions, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transitions, nil
+}
+
+// Close closes the bolt database
+func (bh *BoltHistory) Close() error {
+	return bh.db.Close()
+}
+
+// historyKey sorts by timestamp then sequence. Times outside of what fits in unix nanoseconds are clamped
+func historyKey(t time.Time, seq uint64) []byte {
+	var nanos int64
+	switch {
+	case t.Before(minHistoryTime):
+		nanos = 0
+	case t.After(maxHistoryTime):
+		nanos = math.MaxInt64
+	default:
+		nanos = t.UnixNano()
+	}
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[:8], uint64(nanos))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
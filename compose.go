@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	includeKey   = "include"   // top level list of files or a status replaced by the statuses of a file
+	templatesKey = "templates" // top level map of named status lists
+	templateKey  = "template"  // a status replaced by the statuses of a template
+	varsKey      = "vars"      // variables given to a template
+	forEachKey   = "forEach"   // a status repeated once for each set of variables
+)
+
+var (
+	templateVariable = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+)
+
+// includedFileError is an error in an included file
+type includedFileError struct {
+	file string
+	err  error
+}
+
+func (ife includedFileError) Error() string {
+	return ife.file + ": " + ife.err.Error()
+}
+
+// loadConfigFile decodes a config file along with every file it includes. Included paths are relative to the
+// file including them. The probes, statuses and templates of included files are merged into the returned config.
+// Environment variables and secret files are interpolated in each file. Every file read is returned so they can be watched.
+// Variables which cannot be interpolated are returned as problems, prefixed with the file for included files, and left empty
+func loadConfigFile(fileLocation string, including []string) (map[string]interface{}, []string, []ConfigProblem, error) {
+	for _, f := range including {
+		if f == fileLocation {
+			return nil, nil, nil, fmt.Errorf("include cycle %s -> %s", strings.Join(including, " -> "), fileLocation)
+		}
+	}
+	including = append(including, fileLocation)
+	file, err := ioutil.ReadFile(fileLocation)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	jsonConfig, err := decodeConfig(fileLocation, file)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	decoded := map[string]interface{}{}
+	err = json.Unmarshal(jsonConfig, &decoded)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	files := []string{fileLocation}
+	interpolated, problems := interpolateVariables(decoded, "", filepath.Dir(fileLocation), &files)
+	if len(including) > 1 {
+		for i := range problems {
+			problems[i].Path = fileLocation + ": " + problems[i].Path
+		}
+	}
+	raw := interpolated.(map[string]interface{})
+
+	loadInclude := func(path string, value interface{}) (map[string]interface{}, error) {
+		name, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: must be a file path", path)
+		}
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(fileLocation), name)
+		}
+		included, includedFiles, includedProblems, err := loadConfigFile(name, including)
+		if _, ok := err.(includedFileError); err != nil && !ok {
+			err = includedFileError{file: name, err: err}
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, includedFiles...)
+		problems = append(problems, includedProblems...)
+		return included, mergeIncluded(raw, included)
+	}
+
+	statuses, _ := raw["statuses"].([]interface{})
+	statuses, err = spliceIncludes(statuses, "statuses", loadInclude)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if includes, ok := raw[includeKey]; ok {
+		list, ok := includes.([]interface{})
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("%s: must be a list of file paths", includeKey)
+		}
+		for i, value := range list {
+			included, err := loadInclude(fmt.Sprintf("%s[%d]", includeKey, i), value)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			includedStatuses, _ := included["statuses"].([]interface{})
+			statuses = append(statuses, includedStatuses...)
+		}
+		delete(raw, includeKey)
+	}
+	if statuses != nil {
+		raw["statuses"] = statuses
+	}
+	return raw, files, problems, nil
+}
+
+// spliceIncludes replaces every status which is only an include with the statuses of the included file
+func spliceIncludes(statuses []interface{}, path string, loadInclude func(path string, value interface{}) (map[string]interface{}, error)) ([]interface{}, error) {
+	spliced := []interface{}{}
+	for i, value := range statuses {
+		statusPath := fmt.Sprintf("%s[%d]", path, i)
+		s, ok := value.(map[string]interface{})
+		if !ok {
+			spliced = append(spliced, value)
+			continue
+		}
+		if include, ok := s[includeKey]; ok {
+			included, err := loadInclude(statusPath+"."+includeKey, include)
+			if err != nil {
+				return nil, err
+			}
+			includedStatuses, _ := included["statuses"].([]interface{})
+			spliced = append(spliced, includedStatuses...)
+			continue
+		}
+		if children, ok := s["children"].([]interface{}); ok {
+			children, err := spliceIncludes(children, statusPath+".children", loadInclude)
+			if err != nil {
+				return nil, err
+			}
+			s["children"] = children
+		}
+		spliced = append(spliced, s)
+	}
+	return spliced, nil
+}
+
+// mergeIncluded adds the probes, notifiers and templates of an included config. The statuses are placed by the caller
+func mergeIncluded(raw, included map[string]interface{}) error {
+	for _, key := range []string{"probes", "notifiers"} {
+		if defs, ok := included[key].([]interface{}); ok {
+			existing, _ := raw[key].([]interface{})
+			raw[key] = append(existing, defs...)
+		}
+	}
+	if templates, ok := included[templatesKey].(map[string]interface{}); ok {
+		existing, ok := raw[templatesKey].(map[string]interface{})
+		if !ok {
+			existing = map[string]interface{}{}
+			raw[templatesKey] = existing
+		}
+		for name, template := range templates {
+			if _, ok := existing[name]; ok {
+				return fmt.Errorf("template '%s' is defined more than once", name)
+			}
+			existing[name] = template
+		}
+	}
+	return nil
+}
+
+// expandConfig replaces the templates and forEach generators in the statuses with the statuses they generate
+func expandConfig(raw map[string]interface{}) error {
+	templates := map[string][]interface{}{}
+	if value, ok := raw[templatesKey]; ok {
+		named, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be a map of template names to lists of statuses", templatesKey)
+		}
+		for name, template := range named {
+			list, ok := template.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s.%s: must be a list of statuses", templatesKey, name)
+			}
+			templates[name] = list
+		}
+		delete(raw, templatesKey)
+	}
+	statuses, ok := raw["statuses"].([]interface{})
+	if !ok {
+		return nil
+	}
+	expander := &statusExpander{templates: templates}
+	expanded, err := expander.expand(statuses, "statuses", map[string]string{})
+	if err != nil {
+		return err
+	}
+	raw["statuses"] = expanded
+	return nil
+}
+
+// statusExpander generates statuses from templates and forEach with the variables in scope interpolated
+type statusExpander struct {
+	templates map[string][]interface{}
+	expanding []string // templates being expanded to catch templates using themselves
+}
+
+func (se *statusExpander) expand(statuses []interface{}, path string, vars map[string]string) ([]interface{}, error) {
+	expanded := []interface{}{}
+	for i, value := range statuses {
+		statusPath := fmt.Sprintf("%s[%d]", path, i)
+		s, ok := value.(map[string]interface{})
+		if !ok {
+			expanded = append(expanded, value)
+			continue
+		}
+		generated, err := se.expandStatus(s, statusPath, vars)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, generated...)
+	}
+	return expanded, nil
+}
+
+func (se *statusExpander) expandStatus(s map[string]interface{}, path string, vars map[string]string) ([]interface{}, error) {
+	if forEach, ok := s[forEachKey]; ok {
+		varSets, ok := forEach.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s.%s: must be a list of variables", path, forEachKey)
+		}
+		status := copyWithout(s, forEachKey)
+		generated := []interface{}{}
+		for i, varSet := range varSets {
+			scoped, err := withVars(vars, varSet, fmt.Sprintf("%s.%s[%d]", path, forEachKey, i))
+			if err != nil {
+				return nil, err
+			}
+			statuses, err := se.expandStatus(status, path, scoped)
+			if err != nil {
+				return nil, err
+			}
+			generated = append(generated, statuses...)
+		}
+		return generated, nil
+	}
+
+	if name, ok := s[templateKey]; ok {
+		templateName, _ := name.(string)
+		template, ok := se.templates[templateName]
+		if !ok {
+			return nil, fmt.Errorf("%s.%s: undefined template '%v'", path, templateKey, name)
+		}
+		for _, t := range se.expanding {
+			if t == templateName {
+				return nil, fmt.Errorf("%s.%s: template '%s' uses itself", path, templateKey, templateName)
+			}
+		}
+		scoped, err := withVars(vars, s[varsKey], path+"."+varsKey)
+		if err != nil {
+			return nil, err
+		}
+		se.expanding = append(se.expanding, templateName)
+		defer func() { se.expanding = se.expanding[:len(se.expanding)-1] }()
+		return se.expand(template, templatesKey+"."+templateName, scoped)
+	}
+
+	status := map[string]interface{}{}
+	for key, value := range s {
+		if key == "children" {
+			continue
+		}
+		interpolated, err := interpolate(value, path+"."+key, vars)
+		if err != nil {
+			return nil, err
+		}
+		status[key] = interpolated
+	}
+	if children, ok := s["children"].([]interface{}); ok {
+		expanded, err := se.expand(children, path+".children", vars)
+		if err != nil {
+			return nil, err
+		}
+		status["children"] = expanded
+	}
+	return []interface{}{status}, nil
+}
+
+// withVars returns the variables in scope along with the new ones which take precedence
+func withVars(vars map[string]string, value interface{}, path string) (map[string]string, error) {
+	scoped := map[string]string{}
+	for k, v := range vars {
+		scoped[k] = v
+	}
+	if value == nil {
+		return scoped, nil
+	}
+	newVars, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a map of variable names to values", path)
+	}
+	for k, v := range newVars {
+		scoped[k] = fmt.Sprint(v)
+	}
+	return scoped, nil
+}
+
+// interpolate replaces {{name}} in every string with the value of the variable
+func interpolate(value interface{}, path string, vars map[string]string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		var err error
+		interpolated := templateVariable.ReplaceAllStringFunc(v, func(match string) string {
+			name := templateVariable.FindStringSubmatch(match)[1]
+			value, ok := vars[name]
+			if !ok && err == nil {
+				err = fmt.Errorf("%s: undefined variable '%s'. Defined variables: %s", path, name, strings.Join(sortedKeys(vars), ", "))
+			}
+			return value
+		})
+		return interpolated, err
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for key, child := range v {
+			interpolated, err := interpolate(child, path+"."+key, vars)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = interpolated
+		}
+		return m, nil
+	case []interface{}:
+		list := []interface{}{}
+		for i, child := range v {
+			interpolated, err := interpolate(child, fmt.Sprintf("%s[%d]", path, i), vars)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, interpolated)
+		}
+		return list, nil
+	default:
+		return v, nil
+	}
+}
+
+func copyWithout(m map[string]interface{}, without string) map[string]interface{} {
+	c := map[string]interface{}{}
+	for k, v := range m {
+		if k != without {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config composition", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "compose")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		return path
+	}
+
+	ids := func(statuses []*Status) []string {
+		return fullStatusIDs(statuses)
+	}
+
+	Describe("Given the example config with templates", func() {
+		Context("When it is read", func() {
+			It("Then it should expand to the same statuses as the json config", func() {
+				expected, err := readConfiguration("config_example.json")
+				Expect(err).To(BeNil())
+				config, err := readConfiguration("config_example_templates.yaml")
+				Expect(err).To(BeNil())
+
+				// the json config starts each status differently to show off the colors
+				forEachStatus(expected.Statuses, "", func(fullStatusID string, s *Status) error {
+					s.Status = StatusNone
+					return nil
+				})
+				Expect(config.ProbeDefs).To(Equal(expected.ProbeDefs))
+				Expect(config.Statuses).To(Equal(expected.Statuses))
+			})
+		})
+	})
+
+	Describe("Given a template used with vars", func() {
+		Context("When the config is read", func() {
+			It("Then the vars given to the template should take precedence over the ones in scope", func() {
+				path := writeFile("config.json", `{
+					"templates": {
+						"web": [{"id": "{{app}}-{{region}}", "url": "https://{{app}}.{{region}}.example.com"}]
+					},
+					"statuses": [{
+						"forEach": [{"region": "eu"}, {"region": "us"}],
+						"id": "{{region}}",
+						"children": [
+							{"template": "web", "vars": {"app": "shop"}},
+							{"template": "web", "vars": {"app": "blog", "region": "global"}}
+						]
+					}]
+				}`)
+				config, err := readConfiguration(path)
+				Expect(err).To(BeNil())
+				Expect(ids(config.Statuses)).To(Equal([]string{
+					"eu", "eu#shop-eu", "eu#blog-global",
+					"us", "us#shop-us", "us#blog-global",
+				}))
+				Expect(config.Statuses[1].Children[0].URL).To(Equal("https://shop.us.example.com"))
+			})
+		})
+	})
+
+	Describe("Given templates that cannot be expanded", func() {
+		Context("When a variable is not defined", func() {
+			It("Then the path of the variable should be returned", func() {
+				path := writeFile("config.json", `{
+					"statuses": [{"forEach": [{"env": "pr"}], "id": "{{env}}", "probe": {"data": {"monitorName": "{{service}}"}}}]
+				}`)
+				_, err := readConfiguration(path)
+				Expect(err).To(MatchError(ContainSubstring("statuses[0].probe.data.monitorName: undefined variable 'service'. Defined variables: env")))
+			})
+		})
+		Context("When a template is not defined", func() {
+			It("Then the path of the status should be returned", func() {
+				path := writeFile("config.json", `{"statuses": [{"id": "prod", "children": [{"template": "web"}]}]}`)
+				_, err := readConfiguration(path)
+				Expect(err).To(MatchError(ContainSubstring("statuses[0].children[0].template: undefined template 'web'")))
+			})
+		})
+		Context("When a template uses itself", func() {
+			It("Then an error should be returned", func() {
+				path := writeFile("config.json", `{
+					"templates": {"web": [{"id": "web", "children": [{"template": "web"}]}]},
+					"statuses": [{"template": "web"}]
+				}`)
+				_, err := readConfiguration(path)
+				Expect(err).To(MatchError(ContainSubstring("templates.web[0].children[0].template: template 'web' uses itself")))
+			})
+		})
+	})
+
+	Describe("Given a config including other files", func() {
+		Context("When the config is read", func() {
+			It("Then the included statuses, probes and templates should be merged", func() {
+				writeFile("teams/payments.yaml", `
+probes:
+  - id: payments-http
+    type: HTTP
+    data: {interval: 1m}
+templates:
+  api:
+    - id: "{{name}}-api"
+      probe: {probeRefId: payments-http, data: {url: "https://{{name}}.example.com"}}
+statuses:
+  - template: api
+    vars: {name: cards}
+`)
+				writeFile("teams/search.toml", `
+[[statuses]]
+id = "search"
+`)
+				path := writeFile("config.json", `{
+					"include": ["teams/search.toml"],
+					"statuses": [{
+						"id": "prod",
+						"children": [{"include": "teams/payments.yaml"}, {"template": "api", "vars": {"name": "wallet"}}]
+					}]
+				}`)
+				config, err := readConfiguration(path)
+				Expect(err).To(BeNil())
+				Expect(ids(config.Statuses)).To(Equal([]string{"prod", "prod#cards-api", "prod#wallet-api", "search"}))
+				Expect(config.ProbeDefs).To(HaveLen(1))
+				Expect(config.ProbeDefs[0].ID).To(Equal("payments-http"))
+				Expect(config.files).To(Equal([]string{path, filepath.Join(dir, "teams/payments.yaml"), filepath.Join(dir, "teams/search.toml")}))
+				Expect(validateConfiguration(config)).To(Succeed())
+			})
+		})
+		Context("When an included file is invalid", func() {
+			It("Then the error should name the included file", func() {
+				writeFile("teams/payments.yaml", "statuses:\n  - id: cards\n   fullName: Cards\n")
+				path := writeFile("config.json", `{"statuses": [{"include": "teams/payments.yaml"}]}`)
+				_, err := readConfiguration(path)
+				Expect(err).To(MatchError(ContainSubstring(filepath.Join(dir, "teams/payments.yaml") + ": invalid yaml at line 2")))
+			})
+		})
+		Context("When files include each other", func() {
+			It("Then the cycle should be returned", func() {
+				writeFile("a.json", `{"include": ["b.json"]}`)
+				writeFile("b.json", `{"include": ["a.json"]}`)
+				_, err := readConfiguration(filepath.Join(dir, "a.json"))
+				Expect(err).To(MatchError(ContainSubstring("include cycle")))
+			})
+		})
+		Context("When an included file changes while watched", func() {
+			It("Then the config should be reloaded", func() {
+				writeFile("team.json", `{"statuses": [{"id": "service1"}]}`)
+				path := writeFile("config.json", `{"statuses": [{"id": "prod", "children": [{"include": "team.json"}]}]}`)
+				config, err := readConfiguration(path)
+				Expect(err).To(BeNil())
+				m := NewMonitor(&MonitorConfig{Router: mux.NewRouter(), Statuses: config.Statuses})
+				reloader := NewReloader(path, config, m, []Probe{})
+				defer reloader.Close()
+				Expect(reloader.Watch()).To(Succeed())
+
+				writeFile("team.json", `{"statuses": [{"id": "service1"}, {"id": "service2"}]}`)
+				Eventually(func() error {
+					m.lock.RLock()
+					defer m.lock.RUnlock()
+					_, err := FindStatus("prod#service2", m.statuses)
+					return err
+				}, 5*time.Second).Should(Succeed())
+			})
+		})
+	})
+
+	Describe("Given a config with templates", func() {
+		Context("When it is validated", func() {
+			It("Then the problems should have the paths of the expanded statuses", func() {
+				path := writeFile("config.json", `{
+					"templates": {"services": [{"id": "service1"}, {"id": "service1"}]},
+					"statuses": [{"id": "prod", "children": [{"template": "services"}]}]
+				}`)
+				problems, err := validateConfigFile(path)
+				Expect(err).To(BeNil())
+				Expect(problems).To(Equal([]ConfigProblem{{"statuses[0].children[1].id", "duplicate id 'service1'"}}))
+			})
+		})
+	})
+})
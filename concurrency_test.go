@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Run with `go test -race` to check that the Monitor and Display are safe for concurrent access
+var _ = Describe("Concurrency", func() {
+	var server *httptest.Server
+	var m *Monitor
+	values := []StatusValue{StatusGood, StatusBad, StatusDegraded, StatusUnknown}
+
+	BeforeEach(func() {
+		services := []*Status{}
+		for i := 0; i < 5; i++ {
+			services = append(services, &Status{ID: fmt.Sprintf("service%d", i), Status: StatusGood})
+		}
+		router := mux.NewRouter()
+		m = NewMonitor(&MonitorConfig{
+			Router:   router,
+			Username: "admin",
+			Password: "password",
+			Statuses: []*Status{{ID: "prod", Rollup: &Rollup{Mode: RollupWorst}, Children: services}},
+		})
+		server = httptest.NewServer(router)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	authHeader := func() http.Header {
+		header := http.Header{}
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:password")))
+		return header
+	}
+
+	connect := func() *websocket.Conn {
+		url := "ws://" + strings.TrimPrefix(server.URL, "http://") + "/live"
+		conn, _, err := websocket.DefaultDialer.Dial(url, authHeader())
+		Expect(err).To(BeNil())
+		return conn
+	}
+
+	// statusesByID flattens the status tree into a map of full id to status
+	statusesByID := func(statuses []*Status) map[string]StatusValue {
+		values := map[string]StatusValue{}
+		forEachStatus(statuses, "", func(fullStatusID string, s *Status) error {
+			values[fullStatusID] = s.Status
+			return nil
+		})
+		return values
+	}
+
+	Describe("Given updates, reads and websocket clients at the same time", func() {
+		It("Then a client following the updates should end with the same statuses as the Monitor", func() {
+			follower := connect()
+			defer follower.Close()
+			var snapshot SnapshotMessage
+			Expect(follower.ReadJSON(&snapshot)).To(Succeed())
+			seen := statusesByID(snapshot.Statuses)
+			lastSeq := snapshot.Seq
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					for j := 0; j < 20; j++ {
+						id := fmt.Sprintf("prod#service%d", (i+j)%5)
+						if j%2 == 0 {
+							m.GetUpdateChan() <- StatusUpdate{ID: id, Status: values[(i+j)%4]}
+							continue
+						}
+						Expect(m.UpdateStatusByID(StatusUpdate{ID: id, Status: values[(i*j)%4]})).To(Succeed())
+					}
+				}(i)
+			}
+			for i := 0; i < 2; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					for j := 0; j < 10; j++ {
+						body := fmt.Sprintf(`[{"id": "prod#service%d", "status": "%s"}, {"id": "prod#service%d", "status": "%s"}]`, j%5, values[j%4], (j+1)%5, values[(j+i)%4])
+						r := httptest.NewRequest(http.MethodPost, "/api/v1/updates", bytes.NewBufferString(body))
+						r.Header = authHeader()
+						w := httptest.NewRecorder()
+						m.postUpdatesHandler().ServeHTTP(w, r)
+						Expect(w.Code).To(Equal(http.StatusOK))
+					}
+				}(i)
+			}
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					for j := 0; j < 10; j++ {
+						w := httptest.NewRecorder()
+						m.getStatusHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+						var ss Statuses
+						Expect(json.Unmarshal(w.Body.Bytes(), &ss)).To(Succeed())
+					}
+				}()
+			}
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					for j := 0; j < 5; j++ {
+						conn := connect()
+						var snapshot SnapshotMessage
+						Expect(conn.ReadJSON(&snapshot)).To(Succeed())
+						conn.Close()
+					}
+				}()
+			}
+			wg.Wait()
+
+			// the update channel is processed in the background so wait for the last update to be applied
+			time.Sleep(100 * time.Millisecond)
+			m.display.lock.Lock()
+			finalSeq := m.display.seq
+			m.display.lock.Unlock()
+
+			follower.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for lastSeq < finalSeq {
+				var su StatusUpdate
+				Expect(follower.ReadJSON(&su)).To(Succeed())
+				Expect(su.Seq).To(Equal(lastSeq + 1))
+				lastSeq = su.Seq
+				seen[su.ID] = su.Status
+			}
+
+			m.lock.RLock()
+			expected := statusesByID(m.statuses)
+			m.lock.RUnlock()
+			Expect(seen).To(Equal(expected))
+		})
+	})
+})
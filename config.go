@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	toml "github.com/pelletier/go-toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	// configDecoders convert a config file to json by extension so every format maps onto the same structures
+	configDecoders = map[string]func(file []byte) ([]byte, error){
+		".json": decodeJSONConfig,
+		".yaml": decodeYAMLConfig,
+		".yml":  decodeYAMLConfig,
+		".toml": decodeTOMLConfig,
+	}
+
+	yamlLineError = regexp.MustCompile(`^yaml: line (\d+): `)
+	tomlLineError = regexp.MustCompile(`^\((\d+), (\d+)\): `)
+)
+
+// Configuration is the content of the config file
+type Configuration struct {
+	Name      string        `json:"dashboardName"`
+	Statuses  []*Status     `json:"statuses"`
+	ProbeDefs []ProbeDef    `json:"probes"`
+	Notifiers []NotifierDef `json:"notifiers"`
+
+	files []string // the config file and every file it includes
+}
+
+// ConfigProblem is a problem found in a configuration at a json path like statuses[0].children[1].id
+type ConfigProblem struct {
+	Path    string
+	Message string
+}
+
+func (cp ConfigProblem) String() string {
+	if cp.Path == "" {
+		return cp.Message
+	}
+	return cp.Path + ": " + cp.Message
+}
+
+// ConfigError has every problem found in a configuration
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+func (ce ConfigError) Error() string {
+	problems := []string{}
+	for _, p := range ce.Problems {
+		problems = append(problems, p.String())
+	}
+	return "Invalid configuration: " + strings.Join(problems, "; ")
+}
+
+// readConfiguration reads and parses the config file along with the files it includes and expands any templates.
+// The format of each file is picked by its extension
+func readConfiguration(fileLocation string) (Configuration, error) {
+	var config Configuration
+	raw, files, problems, err := loadConfigFile(fileLocation, nil)
+	if err == nil && len(problems) > 0 {
+		err = ConfigError{Problems: problems}
+	}
+	if err != nil {
+		return config, fmt.Errorf("Error reading config file. Error: %s", err.Error())
+	}
+	err = expandConfig(raw)
+	if err != nil {
+		return config, fmt.Errorf("Error expanding config file. Error: %s", err.Error())
+	}
+	jsonConfig, err := json.Marshal(raw)
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(jsonConfig, &config)
+	if err != nil {
+		return config, fmt.Errorf("Error parsing config file. Error: %s", err.Error())
+	}
+	config.files = files
+	return config, nil
+}
+
+// decodeConfig converts the config file to json using the decoder for its extension
+func decodeConfig(fileLocation string, file []byte) ([]byte, error) {
+	ext := strings.ToLower(filepath.Ext(fileLocation))
+	decoder, ok := configDecoders[ext]
+	if !ok {
+		extensions := []string{}
+		for e := range configDecoders {
+			extensions = append(extensions, e)
+		}
+		sort.Strings(extensions)
+		return nil, fmt.Errorf("unsupported config file extension '%s'. Supported extensions: %s", ext, strings.Join(extensions, ", "))
+	}
+	return decoder(file)
+}
+
+// decodeJSONConfig only checks the syntax so errors have the line and column
+func decodeJSONConfig(file []byte) ([]byte, error) {
+	var raw interface{}
+	err := json.Unmarshal(file, &raw)
+	syntaxErr, ok := err.(*json.SyntaxError)
+	if !ok {
+		return file, nil
+	}
+	// the offset is just after the character that could not be parsed
+	offset := syntaxErr.Offset - 1
+	if offset < 0 {
+		offset = 0
+	}
+	before := file[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return nil, fmt.Errorf("invalid json at line %d, column %d: %s", line, column, err.Error())
+}
+
+func decodeYAMLConfig(file []byte) ([]byte, error) {
+	var raw map[string]interface{}
+	err := yaml.Unmarshal(file, &raw)
+	if err != nil {
+		if match := yamlLineError.FindStringSubmatch(err.Error()); match != nil {
+			return nil, fmt.Errorf("invalid yaml at line %s: %s", match[1], strings.TrimPrefix(err.Error(), match[0]))
+		}
+		return nil, fmt.Errorf("invalid yaml: %s", strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	return json.Marshal(stringKeys(raw))
+}
+
+func decodeTOMLConfig(file []byte) ([]byte, error) {
+	tree, err := toml.LoadBytes(file)
+	if err != nil {
+		if match := tomlLineError.FindStringSubmatch(err.Error()); match != nil {
+			return nil, fmt.Errorf("invalid toml at line %s, column %s: %s", match[1], match[2], strings.TrimPrefix(err.Error(), match[0]))
+		}
+		return nil, fmt.Errorf("invalid toml: %s", err.Error())
+	}
+	return json.Marshal(tree.ToMap())
+}
+
+// stringKeys converts the maps yaml decodes into maps with string keys so they can be written as json
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, child := range v {
+			m[fmt.Sprint(key)] = stringKeys(child)
+		}
+		return m
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = stringKeys(child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = stringKeys(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// validateConfiguration checks the statuses and probes without creating the probes
+func validateConfiguration(config Configuration) error {
+	problems := configProblems(config)
+	if len(problems) > 0 {
+		return ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// configProblems returns every problem found in the probes, notifiers and statuses
+func configProblems(config Configuration) []ConfigProblem {
+	problems := []ConfigProblem{}
+	factories := map[string]ProbeFactory{} // key: probe id
+	for i, def := range config.ProbeDefs {
+		path := fmt.Sprintf("probes[%d]", i)
+		if def.ID == "" {
+			problems = append(problems, ConfigProblem{path + ".id", "missing id"})
+			continue
+		}
+		if _, ok := factories[def.ID]; ok {
+			problems = append(problems, ConfigProblem{path + ".id", "duplicate probe id '" + def.ID + "'"})
+			continue
+		}
+		factory, ok := probeFactories[def.Type]
+		factories[def.ID] = factory
+		if !ok {
+			problems = append(problems, ConfigProblem{path + ".type", fmt.Sprintf("unknown probe type '%s'. Supported types: %s", def.Type, strings.Join(SupportedProbeTypes(), ", "))})
+			continue
+		}
+		problems = append(problems, missingKeys(path+".data", def.Data, factory.RequiredDefKeys, factory.Type)...)
+		if value := def.Data[ProbeIntervalKey]; value != "" {
+			interval, err := time.ParseDuration(value)
+			switch {
+			case err != nil:
+				problems = append(problems, ConfigProblem{path + ".data." + ProbeIntervalKey, "invalid duration '" + value + "'"})
+			case interval <= 0:
+				problems = append(problems, ConfigProblem{path + ".data." + ProbeIntervalKey, "must be greater than 0"})
+			}
+		}
+	}
+	notifierProblems, notifiers := notifierProblems(config.Notifiers)
+	problems = append(problems, notifierProblems...)
+	return append(problems, statusProblems(config.Statuses, "statuses", factories, notifiers)...)
+}
+
+// notifierProblems returns every problem found in the notifiers along with the ids of the notifiers defined
+func notifierProblems(defs []NotifierDef) ([]ConfigProblem, map[string]bool) {
+	problems := []ConfigProblem{}
+	notifiers := map[string]bool{}
+	for i, def := range defs {
+		path := fmt.Sprintf("notifiers[%d]", i)
+		if def.ID == "" {
+			problems = append(problems, ConfigProblem{path + ".id", "missing id"})
+			continue
+		}
+		if notifiers[def.ID] {
+			problems = append(problems, ConfigProblem{path + ".id", "duplicate notifier id '" + def.ID + "'"})
+			continue
+		}
+		notifiers[def.ID] = true
+		factory, ok := notifierFactories[def.Type]
+		if !ok {
+			problems = append(problems, ConfigProblem{path + ".type", fmt.Sprintf("unknown notifier type '%s'. Supported types: %s", def.Type, strings.Join(SupportedNotifierTypes(), ", "))})
+		} else {
+			for _, key := range factory.RequiredKeys {
+				if def.Data[key] == "" {
+					problems = append(problems, ConfigProblem{path + ".data." + key, "required by " + factory.Type + " notifiers"})
+				}
+			}
+		}
+		for j, value := range def.Transitions {
+			if _, err := parseTransition(value); err != nil {
+				problems = append(problems, ConfigProblem{fmt.Sprintf("%s.transitions[%d]", path, j), err.Error()})
+			}
+		}
+		if def.Template != "" {
+			if _, err := parseNotificationTemplate(def.ID, def.Template); err != nil {
+				problems = append(problems, ConfigProblem{path + ".template", err.Error()})
+			}
+		}
+		if _, err := parseNotifierDuration(def.GroupWait); err != nil {
+			problems = append(problems, ConfigProblem{path + ".groupWait", err.Error()})
+		}
+		if _, err := parseNotifierDuration(def.RepeatInterval); err != nil {
+			problems = append(problems, ConfigProblem{path + ".repeatInterval", err.Error()})
+		}
+		if _, _, err := parseRateLimit(def.RateLimit); err != nil {
+			problems = append(problems, ConfigProblem{path + ".rateLimit", err.Error()})
+		}
+	}
+	return problems, notifiers
+}
+
+// statusProblems checks the statuses and their children. Ids only need to be unique among siblings
+func statusProblems(statuses []*Status, path string, factories map[string]ProbeFactory, notifiers map[string]bool) []ConfigProblem {
+	problems := []ConfigProblem{}
+	ids := map[string]bool{}
+	for i, s := range statuses {
+		statusPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case s.ID == "":
+			problems = append(problems, ConfigProblem{statusPath + ".id", "missing id"})
+		case strings.Contains(s.ID, IdDelimiter):
+			problems = append(problems, ConfigProblem{statusPath + ".id", "'" + s.ID + "' must not contain '" + IdDelimiter + "'"})
+		case ids[s.ID]:
+			problems = append(problems, ConfigProblem{statusPath + ".id", "duplicate id '" + s.ID + "'"})
+		}
+		ids[s.ID] = true
+		if s.Status != StatusNone && !s.Status.IsValid() {
+			problems = append(problems, ConfigProblem{statusPath + ".status", InvalidStatusError{Value: string(s.Status)}.Error()})
+		}
+		if s.Probe.RefID != "" {
+			factory, ok := factories[s.Probe.RefID]
+			switch {
+			case !ok:
+				problems = append(problems, ConfigProblem{statusPath + ".probe.probeRefId", "undefined probe '" + s.Probe.RefID + "'"})
+			case factory.Type != "":
+				problems = append(problems, missingKeys(statusPath+".probe.data", s.Probe.Data, factory.RequiredRefKeys, factory.Type)...)
+			}
+		}
+		if s.Rollup != nil {
+			problems = append(problems, rollupProblems(statusPath+".rollup", s.Rollup)...)
+		}
+		if s.ShowUptime != "" {
+			window, err := time.ParseDuration(s.ShowUptime)
+			if err != nil || window <= 0 {
+				problems = append(problems, ConfigProblem{statusPath + ".showUptime", "invalid duration '" + s.ShowUptime + "'"})
+			}
+		}
+		if s.Hysteresis != nil {
+			problems = append(problems, hysteresisProblems(statusPath+".hysteresis", s.Hysteresis)...)
+		}
+		if s.TTL != "" {
+			ttl, err := time.ParseDuration(s.TTL)
+			if err != nil || ttl < 0 {
+				problems = append(problems, ConfigProblem{statusPath + ".ttl", "invalid duration '" + s.TTL + "'"})
+			}
+		}
+		for j, id := range s.Notify {
+			if !notifiers[id] {
+				problems = append(problems, ConfigProblem{fmt.Sprintf("%s.notify[%d]", statusPath, j), "undefined notifier '" + id + "'"})
+			}
+		}
+		problems = append(problems, statusProblems(s.Children, statusPath+".children", factories, notifiers)...)
+	}
+	return problems
+}
+
+func rollupProblems(path string, r *Rollup) []ConfigProblem {
+	problems := []ConfigProblem{}
+	if r.DegradedPercent < 0 || r.DegradedPercent > 100 {
+		problems = append(problems, ConfigProblem{path + ".degradedPercent", "must be between 0 and 100"})
+	}
+	if r.BadPercent < 0 || r.BadPercent > 100 {
+		problems = append(problems, ConfigProblem{path + ".badPercent", "must be between 0 and 100"})
+	}
+	if r.Quorum < 0 {
+		problems = append(problems, ConfigProblem{path + ".quorum", "must not be negative"})
+	}
+	return problems
+}
+
+func hysteresisProblems(path string, h *Hysteresis) []ConfigProblem {
+	problems := []ConfigProblem{}
+	if h.Count < 0 {
+		problems = append(problems, ConfigProblem{path + ".count", "must not be negative"})
+	}
+	if h.For != "" {
+		duration, err := time.ParseDuration(h.For)
+		if err != nil || duration <= 0 {
+			problems = append(problems, ConfigProblem{path + ".for", "invalid duration '" + h.For + "'"})
+		}
+	}
+	if h.FlapChanges < 0 {
+		problems = append(problems, ConfigProblem{path + ".flapChanges", "must not be negative"})
+	}
+	switch {
+	case h.FlapWindow != "":
+		window, err := time.ParseDuration(h.FlapWindow)
+		if err != nil || window <= 0 {
+			problems = append(problems, ConfigProblem{path + ".flapWindow", "invalid duration '" + h.FlapWindow + "'"})
+		}
+	case h.FlapChanges > 0:
+		problems = append(problems, ConfigProblem{path + ".flapWindow", "required by flapChanges"})
+	}
+	return problems
+}
+
+func missingKeys(path string, data map[string]string, requiredKeys []string, probeType string) []ConfigProblem {
+	problems := []ConfigProblem{}
+	for _, key := range requiredKeys {
+		if data[key] == "" {
+			problems = append(problems, ConfigProblem{path + "." + key, "required by " + probeType + " probes"})
+		}
+	}
+	return problems
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "config")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	validateFile := func(name, config string) (int, string) {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte(config), 0600)).To(Succeed())
+		var out bytes.Buffer
+		code := runValidate([]string{"-config", path}, &out)
+		return code, string(bytes.Replace(out.Bytes(), []byte(path), []byte(name), -1))
+	}
+
+	validate := func(config string) (int, string) {
+		return validateFile("config.json", config)
+	}
+
+	Describe("Given the example config", func() {
+		Context("When it is validated", func() {
+			It("Then it should be valid", func() {
+				var out bytes.Buffer
+				Expect(runValidate([]string{"-config", "config_example.json"}, &out)).To(Equal(0))
+				Expect(out.String()).To(Equal("config_example.json: ok\n"))
+			})
+		})
+	})
+
+	Describe("Given the example config in yaml and toml", func() {
+		Context("When they are read", func() {
+			It("Then they should be the same as the json config", func() {
+				expected, err := readConfiguration("config_example.json")
+				Expect(err).To(BeNil())
+				for _, file := range []string{"config_example.yaml", "config_example.toml"} {
+					config, err := readConfiguration(file)
+					Expect(err).To(BeNil())
+					Expect(config.Name).To(Equal(expected.Name), file)
+					Expect(config.ProbeDefs).To(Equal(expected.ProbeDefs), file)
+					Expect(config.Statuses).To(Equal(expected.Statuses), file)
+				}
+			})
+		})
+	})
+
+	Describe("Given a config that cannot be parsed", func() {
+		Context("When it is yaml", func() {
+			It("Then the line should be printed", func() {
+				code, out := validateFile("config.yml", "statuses:\n  - id: prod\n   fullName: Production\n")
+				Expect(code).To(Equal(1))
+				Expect(out).To(HavePrefix("config.yml: invalid yaml at line 2: "))
+			})
+		})
+		Context("When it is toml", func() {
+			It("Then the line and column should be printed", func() {
+				code, out := validateFile("config.toml", "[[statuses]]\nid = \"prod\"\nfullName = Production\n")
+				Expect(code).To(Equal(1))
+				Expect(out).To(HavePrefix("config.toml: invalid toml at line 3, column 12: "))
+			})
+		})
+		Context("When the extension is not supported", func() {
+			It("Then the supported extensions should be printed", func() {
+				code, out := validateFile("config.ini", "")
+				Expect(code).To(Equal(1))
+				Expect(out).To(HavePrefix("config.ini: unsupported config file extension '.ini'. Supported extensions: .json, .toml, .yaml, .yml"))
+			})
+		})
+	})
+
+	Describe("Given an invalid yaml config", func() {
+		Context("When it is validated", func() {
+			It("Then the problems should have the same paths as json", func() {
+				code, out := validateFile("config.yaml", `
+statuses:
+  - id: prod
+    children:
+      - id: service1
+        status: fine
+      - id: service1
+`)
+				Expect(code).To(Equal(1))
+				Expect(out).To(Equal(`config.yaml: statuses[0].children[0].status: Invalid status 'fine'. Must be one of: good, bad, degraded, unknown
+config.yaml: statuses[0].children[1].id: duplicate id 'service1'
+config.yaml: 2 problem(s) found
+`))
+			})
+		})
+	})
+
+	Describe("Given an invalid config", func() {
+		Context("When it is validated", func() {
+			It("Then every problem should be printed with its path", func() {
+				code, out := validate(`{
+					"probes": [
+						{"id": "http", "type": "HTTP", "data": {"interval": "soon"}},
+						{"id": "http", "type": "HTTP", "data": {"interval": "1m"}},
+						{"id": "other", "type": "Carrier Pigeon"}
+					],
+					"statuses": [{
+						"id": "prod",
+						"rollup": {"mode": "quorum", "quorum": -1},
+						"children": [
+							{"id": "service1", "probe": {"probeRefId": "http"}},
+							{"id": "service1", "status": "fine"},
+							{"id": "service#2", "probe": {"probeRefId": "missing"}, "showUptime": "a while"},
+							{"id": "service3", "rollup": {"mode": "average"}}
+						]
+					}]
+				}`)
+				Expect(code).To(Equal(1))
+				Expect(out).To(Equal(`config.json: statuses[0].children[1].status: Invalid status 'fine'. Must be one of: good, bad, degraded, unknown
+config.json: statuses[0].children[3].rollup: Invalid roll-up mode 'average'. Must be one of: worst, best, percentage, quorum
+config.json: probes[0].data.interval: invalid duration 'soon'
+config.json: probes[1].id: duplicate probe id 'http'
+config.json: probes[2].type: unknown probe type 'Carrier Pigeon'. Supported types: DNS, Exec, GRPCHealth, HTTP, NewRelic, Prometheus, TCP, TLSCert
+config.json: statuses[0].rollup.quorum: must not be negative
+config.json: statuses[0].children[0].probe.data.url: required by HTTP probes
+config.json: statuses[0].children[1].id: duplicate id 'service1'
+config.json: statuses[0].children[2].id: 'service#2' must not contain '#'
+config.json: statuses[0].children[2].probe.probeRefId: undefined probe 'missing'
+config.json: statuses[0].children[2].showUptime: invalid duration 'a while'
+config.json: 11 problem(s) found
+`))
+			})
+		})
+		Context("When it is not valid json", func() {
+			It("Then the line and column should be printed", func() {
+				code, out := validate("{\n  \"statuses\": [\n    {\"id\": \"prod\",}\n  ]\n}")
+				Expect(code).To(Equal(1))
+				Expect(out).To(HavePrefix("config.json: invalid json at line 3, column 19: "))
+			})
+		})
+		Context("When it is used by the running monitor", func() {
+			It("Then it should be an error with every problem", func() {
+				err := validateConfiguration(Configuration{Statuses: []*Status{{ID: "prod"}, {ID: "prod"}}})
+				Expect(err).To(MatchError("Invalid configuration: statuses[1].id: duplicate id 'prod'"))
+			})
+		})
+	})
+})
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	DNSType           = "DNS"
+	DNSIntervalKey    = "interval"
+	DNSTimeoutKey     = "timeout"
+	DNSResolverKey    = "resolver"
+	DNSNameKey        = "name"
+	DNSRecordTypeKey  = "recordType"
+	DNSExpectedKey    = "expected"
+	defaultDNSTimeout = 5 * time.Second
+	defaultDNSType    = "A"
+	resolvConf        = "/etc/resolv.conf"
+)
+
+var (
+	// dnsRecordTypes are the record types a status can check
+	dnsRecordTypes = map[string]uint16{
+		"A":     dns.TypeA,
+		"AAAA":  dns.TypeAAAA,
+		"CNAME": dns.TypeCNAME,
+		"TXT":   dns.TypeTXT,
+		"SRV":   dns.TypeSRV,
+	}
+)
+
+// DNSProbeConfig is the configuration for a dns probe
+type DNSProbeConfig struct {
+	id       string
+	update   chan StatusUpdate
+	health   chan ProbeReport
+	interval time.Duration
+	timeout  time.Duration
+	resolver string // host:port of the resolver
+}
+
+// DNSProbe is a probe that resolves names and compares the answers with the expected ones
+type DNSProbe struct {
+	refID    string
+	update   chan StatusUpdate
+	health   chan ProbeReport
+	interval time.Duration
+	resolver string
+	ticker   *time.Ticker
+	stopChan chan bool
+	client   *dns.Client
+	checks   []*dnsCheck
+}
+
+// dnsCheck is a single name to resolve belonging to a status
+type dnsCheck struct {
+	statusID   string
+	name       string
+	recordType uint16
+	expected   []string // sorted and normalized, any answer is good if empty
+}
+
+func init() {
+	RegisterProbeFactory(ProbeFactory{
+		Type:            DNSType,
+		RequiredDefKeys: []string{DNSIntervalKey},
+		RequiredRefKeys: []string{DNSNameKey},
+		New:             newDNSProbeFromConfig,
+	})
+}
+
+// newDNSProbeFromConfig creates and initializes a dns probe for the probe registry.
+// The first nameserver of /etc/resolv.conf is used if no resolver is given
+func newDNSProbeFromConfig(config ProbeConfig, statuses []*Status) (Probe, error) {
+	var timeout time.Duration
+	if config.Data[DNSTimeoutKey] != "" {
+		var err error
+		timeout, err = time.ParseDuration(config.Data[DNSTimeoutKey])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %s", DNSTimeoutKey, err.Error())
+		}
+	}
+	resolver := config.Data[DNSResolverKey]
+	if resolver == "" {
+		clientConfig, err := dns.ClientConfigFromFile(resolvConf)
+		if err != nil || len(clientConfig.Servers) == 0 {
+			return nil, fmt.Errorf("No %s given and no nameserver found in %s", DNSResolverKey, resolvConf)
+		}
+		resolver = net.JoinHostPort(clientConfig.Servers[0], clientConfig.Port)
+	}
+	dp := NewDNSProbe(&DNSProbeConfig{
+		id:       config.ID,
+		update:   config.Update,
+		health:   config.Health,
+		interval: config.Interval,
+		timeout:  timeout,
+		resolver: resolver,
+	})
+	err := dp.Initialize(statuses)
+	if err != nil {
+		return nil, err
+	}
+	return dp, nil
+}
+
+// NewDNSProbe returns a dns probe. Port 53 is used if the resolver has no port
+func NewDNSProbe(config *DNSProbeConfig) *DNSProbe {
+	timeout := config.timeout
+	if timeout == 0 {
+		timeout = defaultDNSTimeout
+	}
+	resolver := config.resolver
+	if _, _, err := net.SplitHostPort(resolver); err != nil {
+		resolver = net.JoinHostPort(resolver, "53")
+	}
+	return &DNSProbe{
+		refID:    config.id,
+		update:   config.update,
+		health:   config.health,
+		interval: config.interval,
+		resolver: resolver,
+		stopChan: make(chan bool),
+		client:   &dns.Client{Timeout: timeout},
+		checks:   []*dnsCheck{},
+	}
+}
+
+// Initialize parses through all status to find which names need to be resolved
+func (dp *DNSProbe) Initialize(statuses []*Status) error {
+	return forEachProbeRef(dp.refID, statuses, func(fullStatusID string, s *Status) error {
+		check, err := newDNSCheck(fullStatusID, s)
+		if err != nil {
+			return err
+		}
+		dp.checks = append(dp.checks, check)
+		return nil
+	})
+}
+
+// Start begins resolving all names at the given interval
+func (dp *DNSProbe) Start() {
+	if dp.ticker == nil {
+		logger.Debug("Starting DNS Probe", "refID", dp.refID)
+		dp.ticker = time.NewTicker(dp.interval)
+		dp.probe()
+		for {
+			select {
+			case <-dp.ticker.C:
+				dp.probe()
+			case <-dp.stopChan:
+				dp.ticker.Stop()
+				dp.ticker = nil
+				logger.Debug("Exiting DNS Probe", "refID", dp.refID)
+				return
+			}
+		}
+	}
+}
+
+// Stop stops resolving names
+func (dp *DNSProbe) Stop() {
+	dp.stopChan <- true
+}
+
+// probe runs all checks concurrently. Names which cannot be resolved are reported as bad statuses
+// so the probe itself always reports healthy
+func (dp *DNSProbe) probe() {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, check := range dp.checks {
+		wg.Add(1)
+		go func(c *dnsCheck) {
+			defer wg.Done()
+			status, message := dp.runCheck(c)
+			dp.update <- StatusUpdate{
+				ID:      c.statusID,
+				Status:  status,
+				Source:  dp.refID,
+				Message: message,
+			}
+		}(check)
+	}
+	wg.Wait()
+	reportProbeHealth(dp.health, dp.refID, start, nil)
+}
+
+// runCheck resolves the name and returns bad if it does not exist, has no records of the type or the resolver
+// does not answer in time and degraded if the answers are not the expected ones
+func (dp *DNSProbe) runCheck(c *dnsCheck) (StatusValue, string) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(c.name), c.recordType)
+	resp, _, err := dp.client.Exchange(msg, dp.resolver)
+	if err != nil {
+		logger.Debug("DNS check failed", "refID", dp.refID, "name", c.name, "error", err)
+		return StatusBad, err.Error()
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return StatusBad, dns.RcodeToString[resp.Rcode]
+	}
+
+	answers := dnsAnswers(resp.Answer, c.recordType)
+	if len(answers) == 0 {
+		return StatusBad, fmt.Sprintf("no %s records", dns.TypeToString[c.recordType])
+	}
+	message := strings.Join(answers, ", ")
+	if len(c.expected) > 0 && !equalStrings(c.expected, answers) {
+		return StatusDegraded, fmt.Sprintf("got %s but expected %s", message, strings.Join(c.expected, ", "))
+	}
+	return StatusGood, message
+}
+
+// dnsAnswers returns the sorted values of the records of the type. Other records like the CNAME
+// followed to get an A record are ignored
+func dnsAnswers(records []dns.RR, recordType uint16) []string {
+	answers := []string{}
+	for _, rr := range records {
+		if rr.Header().Rrtype != recordType {
+			continue
+		}
+		switch r := rr.(type) {
+		case *dns.A:
+			answers = append(answers, r.A.String())
+		case *dns.AAAA:
+			answers = append(answers, r.AAAA.String())
+		case *dns.CNAME:
+			answers = append(answers, normalizeDNSName(r.Target))
+		case *dns.TXT:
+			answers = append(answers, strings.Join(r.Txt, ""))
+		case *dns.SRV:
+			answers = append(answers, fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, normalizeDNSName(r.Target)))
+		}
+	}
+	sort.Strings(answers)
+	return answers
+}
+
+func newDNSCheck(fullStatusID string, s *Status) (*dnsCheck, error) {
+	data := s.Probe.Data
+	if data[DNSNameKey] == "" {
+		return nil, fmt.Errorf("%s is missing '%s' field in 'data' for DNS probe", s.FullName, DNSNameKey)
+	}
+	typeName := strings.ToUpper(data[DNSRecordTypeKey])
+	if typeName == "" {
+		typeName = defaultDNSType
+	}
+	recordType, ok := dnsRecordTypes[typeName]
+	if !ok {
+		types := []string{}
+		for t := range dnsRecordTypes {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		return nil, fmt.Errorf("%s has invalid '%s' for DNS probe: '%s'. Must be one of: %s", s.FullName, DNSRecordTypeKey, data[DNSRecordTypeKey], strings.Join(types, ", "))
+	}
+
+	// TXT records may contain commas so they are matched whole
+	expected := []string{}
+	if data[DNSExpectedKey] != "" {
+		values := []string{data[DNSExpectedKey]}
+		if recordType != dns.TypeTXT {
+			values = strings.Split(data[DNSExpectedKey], ",")
+		}
+		for _, value := range values {
+			value = strings.TrimSpace(value)
+			if recordType == dns.TypeCNAME || recordType == dns.TypeSRV {
+				value = normalizeDNSName(value)
+			}
+			if recordType == dns.TypeA || recordType == dns.TypeAAAA {
+				ip := net.ParseIP(value)
+				if ip == nil {
+					return nil, fmt.Errorf("%s has invalid '%s' for DNS probe: '%s' is not an IP address", s.FullName, DNSExpectedKey, value)
+				}
+				value = ip.String()
+			}
+			expected = append(expected, value)
+		}
+		sort.Strings(expected)
+	}
+	return &dnsCheck{
+		statusID:   fullStatusID,
+		name:       data[DNSNameKey],
+		recordType: recordType,
+		expected:   expected,
+	}, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeDNSName lowercases names and removes the trailing dot so 'API.example.com.' matches 'api.example.com'
+func normalizeDNSName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
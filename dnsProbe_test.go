@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DNSProbe", func() {
+	var server *dns.Server
+	var update chan StatusUpdate
+
+	// the zone served by the in-process resolver
+	records := map[string][]string{
+		"api.example.com.": {
+			"api.example.com. 60 IN A 10.0.0.2",
+			"api.example.com. 60 IN A 10.0.0.1",
+		},
+		"www.example.com.": {
+			"www.example.com. 60 IN CNAME API.example.com.",
+			"API.example.com. 60 IN A 10.0.0.1",
+		},
+		"example.com.": {
+			`example.com. 60 IN TXT "v=spf1 include:mail.example.com -all"`,
+		},
+		"_postgres._tcp.example.com.": {
+			"_postgres._tcp.example.com. 60 IN SRV 10 5 5432 db.example.com.",
+		},
+	}
+
+	BeforeEach(func() {
+		update = make(chan StatusUpdate, 10)
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		server = &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			defer GinkgoRecover()
+			q := req.Question[0]
+			if q.Name == "slow.example.com." {
+				return // never answer so the query times out
+			}
+			resp := new(dns.Msg)
+			resp.SetReply(req)
+			zone, ok := records[q.Name]
+			if !ok {
+				resp.SetRcode(req, dns.RcodeNameError)
+			}
+			for _, record := range zone {
+				rr, err := dns.NewRR(record)
+				Expect(err).To(BeNil())
+				if rr.Header().Rrtype == q.Qtype || rr.Header().Rrtype == dns.TypeCNAME {
+					resp.Answer = append(resp.Answer, rr)
+				}
+			}
+			w.WriteMsg(resp)
+		})}
+		started := make(chan bool)
+		server.NotifyStartedFunc = func() { close(started) }
+		go server.ActivateAndServe()
+		<-started
+	})
+
+	AfterEach(func() {
+		server.Shutdown()
+	})
+
+	check := func(data map[string]string) StatusUpdate {
+		dp := NewDNSProbe(&DNSProbeConfig{
+			id:       "dns",
+			update:   update,
+			interval: time.Minute,
+			timeout:  200 * time.Millisecond,
+			resolver: server.PacketConn.LocalAddr().String(),
+		})
+		err := dp.Initialize([]*Status{{
+			ID:    "api",
+			Probe: ProbeRef{RefID: "dns", Data: data},
+		}})
+		Expect(err).To(BeNil())
+		dp.probe()
+		return <-update
+	}
+
+	Describe("Given a status referencing a DNS probe", func() {
+		Context("When the answers are the expected ones", func() {
+			It("Then the status should be good", func() {
+				Expect(check(map[string]string{DNSNameKey: "api.example.com", DNSExpectedKey: "10.0.0.1, 10.0.0.2"})).To(Equal(StatusUpdate{
+					ID:      "api",
+					Status:  StatusGood,
+					Source:  "dns",
+					Message: "10.0.0.1, 10.0.0.2",
+				}))
+				Expect(check(map[string]string{DNSNameKey: "www.example.com", DNSRecordTypeKey: "cname", DNSExpectedKey: "api.example.com"}).Status).To(Equal(StatusGood))
+				Expect(check(map[string]string{DNSNameKey: "example.com", DNSRecordTypeKey: "TXT", DNSExpectedKey: "v=spf1 include:mail.example.com -all"}).Status).To(Equal(StatusGood))
+				Expect(check(map[string]string{DNSNameKey: "_postgres._tcp.example.com", DNSRecordTypeKey: "SRV", DNSExpectedKey: "10 5 5432 db.example.com."}).Status).To(Equal(StatusGood))
+			})
+			It("Then any answer should be good if none are expected", func() {
+				Expect(check(map[string]string{DNSNameKey: "www.example.com"}).Status).To(Equal(StatusGood))
+			})
+		})
+		Context("When the answers are not the expected ones", func() {
+			It("Then the status should be degraded", func() {
+				Expect(check(map[string]string{DNSNameKey: "api.example.com", DNSExpectedKey: "10.0.0.1"})).To(Equal(StatusUpdate{
+					ID:      "api",
+					Status:  StatusDegraded,
+					Source:  "dns",
+					Message: "got 10.0.0.1, 10.0.0.2 but expected 10.0.0.1",
+				}))
+			})
+		})
+		Context("When the name does not exist or has no records of the type", func() {
+			It("Then the status should be bad", func() {
+				Expect(check(map[string]string{DNSNameKey: "gone.example.com"})).To(Equal(StatusUpdate{ID: "api", Status: StatusBad, Source: "dns", Message: "NXDOMAIN"}))
+				Expect(check(map[string]string{DNSNameKey: "api.example.com", DNSRecordTypeKey: "AAAA"}).Message).To(Equal("no AAAA records"))
+			})
+		})
+		Context("When the resolver does not answer in time", func() {
+			It("Then the status should be bad", func() {
+				su := check(map[string]string{DNSNameKey: "slow.example.com"})
+				Expect(su.Status).To(Equal(StatusBad))
+				Expect(su.Message).To(ContainSubstring("timeout"))
+			})
+		})
+		Context("When the probe data is invalid", func() {
+			It("Then it should error on initialize", func() {
+				statuses := func(data map[string]string) []*Status {
+					return []*Status{{ID: "api", Probe: ProbeRef{RefID: "dns", Data: data}}}
+				}
+				dp := NewDNSProbe(&DNSProbeConfig{id: "dns", resolver: "127.0.0.1"})
+				Expect(dp.resolver).To(Equal("127.0.0.1:53"))
+				Expect(dp.Initialize(statuses(map[string]string{}))).ToNot(BeNil())
+				Expect(dp.Initialize(statuses(map[string]string{DNSNameKey: "example.com", DNSRecordTypeKey: "MX"}))).ToNot(BeNil())
+				Expect(dp.Initialize(statuses(map[string]string{DNSNameKey: "example.com", DNSExpectedKey: "not an ip"}))).ToNot(BeNil())
+			})
+		})
+	})
+})
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ExecType                 = "Exec"
+	ExecIntervalKey          = "interval"
+	ExecTimeoutKey           = "timeout"
+	ExecMaxConcurrentKey     = "maxConcurrent"
+	ExecCommandKey           = "command"
+	ExecOutputKey            = "output"
+	ExecOutputMessage        = "message"
+	ExecOutputSubText        = "subText"
+	defaultExecTimeout       = 10 * time.Second
+	defaultExecConcurrent    = 4
+	defaultExecMaxConcurrent = 8           // commands of all exec probes running at the same time, set with EXEC_MAX_CONCURRENT
+	maxExecOutputSize        = 64 << 10    // plugins only need the first line
+	execKillWait             = time.Second // how long to wait for the output of a killed command to be closed
+)
+
+var (
+	// execStatuses maps the exit codes of Nagios plugins to statuses. Any other exit code is unknown
+	execStatuses = map[int]StatusValue{
+		0: StatusGood,
+		1: StatusDegraded,
+		2: StatusBad,
+		3: StatusUnknown,
+	}
+
+	// execSlots limits how many commands run at the same time across all exec probes so many probes cannot overload the host
+	execSlots = make(chan bool, defaultExecMaxConcurrent)
+)
+
+// ExecProbeConfig is the configuration for an exec probe
+type ExecProbeConfig struct {
+	id            string
+	update        chan StatusUpdate
+	health        chan ProbeReport
+	interval      time.Duration
+	timeout       time.Duration
+	maxConcurrent int
+}
+
+// ExecProbe is a probe that runs Nagios style check commands and maps their exit codes to statuses
+type ExecProbe struct {
+	refID    string
+	update   chan StatusUpdate
+	health   chan ProbeReport
+	interval time.Duration
+	timeout  time.Duration
+	slots    chan bool // limits how many commands of this probe run at the same time
+	ticker   *time.Ticker
+	stopChan chan bool
+	checks   []*execCheck
+}
+
+// execCheck is a single command belonging to a status
+type execCheck struct {
+	statusID string
+	command  string
+	timeout  time.Duration
+	output   string // where the first line of output goes: message or subText
+}
+
+// limitedBuffer keeps the first bytes written to it and discards the rest so a noisy command cannot use up memory
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	if room := lb.limit - lb.Len(); room > 0 {
+		if len(p) > room {
+			lb.Buffer.Write(p[:room])
+		} else {
+			lb.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func init() {
+	RegisterProbeFactory(ProbeFactory{
+		Type:            ExecType,
+		RequiredDefKeys: []string{ExecIntervalKey},
+		RequiredRefKeys: []string{ExecCommandKey},
+		New:             newExecProbeFromConfig,
+	})
+}
+
+// newExecProbeFromConfig creates and initializes an exec probe for the probe registry
+func newExecProbeFromConfig(config ProbeConfig, statuses []*Status) (Probe, error) {
+	var err error
+	var timeout time.Duration
+	if config.Data[ExecTimeoutKey] != "" {
+		timeout, err = time.ParseDuration(config.Data[ExecTimeoutKey])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %s", ExecTimeoutKey, err.Error())
+		}
+	}
+	var maxConcurrent int
+	if config.Data[ExecMaxConcurrentKey] != "" {
+		maxConcurrent, err = strconv.Atoi(config.Data[ExecMaxConcurrentKey])
+		if err != nil || maxConcurrent <= 0 {
+			return nil, fmt.Errorf("Invalid %s: must be a number greater than 0", ExecMaxConcurrentKey)
+		}
+	}
+	ep := NewExecProbe(&ExecProbeConfig{
+		id:            config.ID,
+		update:        config.Update,
+		health:        config.Health,
+		interval:      config.Interval,
+		timeout:       timeout,
+		maxConcurrent: maxConcurrent,
+	})
+	err = ep.Initialize(statuses)
+	if err != nil {
+		return nil, err
+	}
+	return ep, nil
+}
+
+// NewExecProbe returns an exec probe
+func NewExecProbe(config *ExecProbeConfig) *ExecProbe {
+	timeout := config.timeout
+	if timeout == 0 {
+		timeout = defaultExecTimeout
+	}
+	maxConcurrent := config.maxConcurrent
+	if maxConcurrent == 0 {
+		maxConcurrent = defaultExecConcurrent
+	}
+	return &ExecProbe{
+		refID:    config.id,
+		update:   config.update,
+		health:   config.health,
+		interval: config.interval,
+		timeout:  timeout,
+		slots:    make(chan bool, maxConcurrent),
+		stopChan: make(chan bool),
+		checks:   []*execCheck{},
+	}
+}
+
+// Initialize parses through all status to find which commands need to be run
+func (ep *ExecProbe) Initialize(statuses []*Status) error {
+	return forEachProbeRef(ep.refID, statuses, func(fullStatusID string, s *Status) error {
+		check, err := ep.newCheck(fullStatusID, s)
+		if err != nil {
+			return err
+		}
+		ep.checks = append(ep.checks, check)
+		return nil
+	})
+}
+
+// Start begins running all commands at the given interval
+func (ep *ExecProbe) Start() {
+	if ep.ticker == nil {
+		logger.Debug("Starting Exec Probe", "refID", ep.refID)
+		ep.ticker = time.NewTicker(ep.interval)
+		ep.probe()
+		for {
+			select {
+			case <-ep.ticker.C:
+				ep.probe()
+			case <-ep.stopChan:
+				ep.ticker.Stop()
+				ep.ticker = nil
+				logger.Debug("Exiting Exec Probe", "refID", ep.refID)
+				return
+			}
+		}
+	}
+}
+
+// Stop stops running commands
+func (ep *ExecProbe) Stop() {
+	ep.stopChan <- true
+}
+
+// probe runs all commands with at most maxConcurrent of this probe and the limit of all exec probes at a time.
+// Commands which cannot be started make the probe unhealthy
+func (ep *ExecProbe) probe() {
+	start := time.Now()
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var probeErr error
+	for _, check := range ep.checks {
+		wg.Add(1)
+		go func(c *execCheck) {
+			defer wg.Done()
+			ep.slots <- true
+			execSlots <- true
+			status, output, err := ep.runCheck(c)
+			<-execSlots
+			<-ep.slots
+			if err != nil {
+				logger.Debug("Exec check could not run", "refID", ep.refID, "command", c.command, "error", err)
+				lock.Lock()
+				if probeErr == nil {
+					probeErr = err
+				}
+				lock.Unlock()
+			}
+			su := StatusUpdate{ID: c.statusID, Status: status, Source: ep.refID}
+			if c.output == ExecOutputSubText {
+				su.SubText = output
+			} else {
+				su.Message = output
+			}
+			ep.update <- su
+		}(check)
+	}
+	wg.Wait()
+	reportProbeHealth(ep.health, ep.refID, start, probeErr)
+}
+
+// runCheck runs the command and returns the status of its exit code along with the first line of its output.
+// Commands taking longer than the timeout are killed and unknown without waiting long for anything they started. An error is returned if the command could not be started
+func (ep *ExecProbe) runCheck(c *execCheck) (StatusValue, string, error) {
+	cmd := newShellCommand(c.command)
+	stdout := &limitedBuffer{limit: maxExecOutputSize}
+	stderr := &limitedBuffer{limit: maxExecOutputSize}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Start()
+	if err != nil {
+		return StatusUnknown, err.Error(), err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case err = <-done:
+	case <-timer.C:
+		killCommand(cmd)
+		// a process which left the process group may keep the output open, which Wait waits for
+		select {
+		case <-done:
+		case <-time.After(execKillWait):
+			logger.Warning("Killed command still has its output open", "refID", ep.refID, "command", c.command)
+		}
+		return StatusUnknown, fmt.Sprintf("timed out after %s", c.timeout), nil
+	}
+
+	exitCode := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return StatusUnknown, err.Error(), err
+	}
+	status, ok := execStatuses[exitCode]
+	if !ok {
+		status = StatusUnknown
+	}
+	output := pluginOutput(stdout.String())
+	if output == "" && exitCode != 0 {
+		output = pluginOutput(stderr.String())
+	}
+	if output == "" {
+		output = fmt.Sprintf("exit code %d", exitCode)
+	}
+	return status, output, nil
+}
+
+// setExecMaxConcurrent sets how many commands of all exec probes run at the same time. Must be called before any probe starts
+func setExecMaxConcurrent(max int) error {
+	if max <= 0 {
+		return fmt.Errorf("Invalid exec max concurrent %d: must be greater than 0", max)
+	}
+	execSlots = make(chan bool, max)
+	return nil
+}
+
+// pluginOutput returns the first line of the output of a plugin without the performance data after '|'
+func pluginOutput(output string) string {
+	line := strings.SplitN(output, "\n", 2)[0]
+	line = strings.SplitN(line, "|", 2)[0]
+	return strings.TrimSpace(line)
+}
+
+func (ep *ExecProbe) newCheck(fullStatusID string, s *Status) (*execCheck, error) {
+	data := s.Probe.Data
+	if data[ExecCommandKey] == "" {
+		return nil, fmt.Errorf("%s is missing '%s' field in 'data' for Exec probe", s.FullName, ExecCommandKey)
+	}
+	output := data[ExecOutputKey]
+	switch output {
+	case "":
+		output = ExecOutputMessage
+	case ExecOutputMessage, ExecOutputSubText:
+	default:
+		return nil, fmt.Errorf("%s has invalid '%s' for Exec probe: '%s'. Must be %s or %s", s.FullName, ExecOutputKey, output, ExecOutputMessage, ExecOutputSubText)
+	}
+
+	timeout := ep.timeout
+	if data[ExecTimeoutKey] != "" {
+		var err error
+		timeout, err = time.ParseDuration(data[ExecTimeoutKey])
+		if err != nil {
+			return nil, fmt.Errorf("%s has invalid '%s' for Exec probe: %s", s.FullName, ExecTimeoutKey, err.Error())
+		}
+	}
+	return &execCheck{
+		statusID: fullStatusID,
+		command:  data[ExecCommandKey],
+		timeout:  timeout,
+		output:   output,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExecProbe", func() {
+	var update chan StatusUpdate
+	var health chan ProbeReport
+
+	BeforeEach(func() {
+		update = make(chan StatusUpdate, 10)
+		health = make(chan ProbeReport, 10)
+	})
+
+	newProbe := func(config *ExecProbeConfig, data ...map[string]string) *ExecProbe {
+		config.id = "exec"
+		config.update = update
+		config.health = health
+		config.interval = time.Minute
+		ep := NewExecProbe(config)
+		statuses := []*Status{}
+		for i, d := range data {
+			statuses = append(statuses, &Status{ID: fmt.Sprintf("check%d", i), Probe: ProbeRef{RefID: "exec", Data: d}})
+		}
+		Expect(ep.Initialize(statuses)).To(Succeed())
+		return ep
+	}
+
+	check := func(data map[string]string) StatusUpdate {
+		newProbe(&ExecProbeConfig{}, data).probe()
+		return <-update
+	}
+
+	Describe("Given a status referencing an Exec probe", func() {
+		Context("When the command exits", func() {
+			It("Then the exit code should map to the status like a Nagios plugin", func() {
+				Expect(check(map[string]string{ExecCommandKey: `echo "DISK OK - free space: / 3326 MB (56%) | /=2643MB;5948;5958"; echo details; exit 0`})).To(Equal(StatusUpdate{
+					ID:      "check0",
+					Status:  StatusGood,
+					Source:  "exec",
+					Message: "DISK OK - free space: / 3326 MB (56%)",
+				}))
+				Expect(check(map[string]string{ExecCommandKey: "echo DISK WARNING; exit 1"}).Status).To(Equal(StatusDegraded))
+				Expect(check(map[string]string{ExecCommandKey: "echo DISK CRITICAL; exit 2"}).Status).To(Equal(StatusBad))
+				Expect(check(map[string]string{ExecCommandKey: "echo DISK UNKNOWN; exit 3"}).Status).To(Equal(StatusUnknown))
+				Expect(check(map[string]string{ExecCommandKey: "exit 7"}).Status).To(Equal(StatusUnknown))
+				Expect((<-health).Err).To(BeNil())
+			})
+			It("Then stderr should be the message if there is no output", func() {
+				Expect(check(map[string]string{ExecCommandKey: "does-not-exist-check"}).Message).To(ContainSubstring("not found"))
+			})
+			It("Then the exit code should be the message if there is no output", func() {
+				Expect(check(map[string]string{ExecCommandKey: "true"}).Message).To(Equal("exit code 0"))
+				Expect(check(map[string]string{ExecCommandKey: "exit 2"}).Message).To(Equal("exit code 2"))
+			})
+			It("Then the output should be the sub-text if configured", func() {
+				Expect(check(map[string]string{ExecCommandKey: "echo 42 connections", ExecOutputKey: ExecOutputSubText})).To(Equal(StatusUpdate{
+					ID:      "check0",
+					Status:  StatusGood,
+					Source:  "exec",
+					SubText: "42 connections",
+				}))
+			})
+		})
+		Context("When the command takes longer than the timeout", func() {
+			It("Then it should be killed along with its children and be unknown", func() {
+				start := time.Now()
+				su := check(map[string]string{ExecCommandKey: "sleep 5 & sleep 5", ExecTimeoutKey: "100ms"})
+				Expect(su.Status).To(Equal(StatusUnknown))
+				Expect(su.Message).To(Equal("timed out after 100ms"))
+				Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+			})
+		})
+		Context("When the command started a process which keeps its output open after the timeout", func() {
+			It("Then it should not wait for the process to exit", func() {
+				start := time.Now()
+				su := check(map[string]string{ExecCommandKey: "setsid sleep 10 & sleep 10", ExecTimeoutKey: "100ms"})
+				Expect(su.Status).To(Equal(StatusUnknown))
+				Expect(time.Since(start)).To(BeNumerically("<", 3*time.Second))
+			})
+		})
+		Context("When there are more commands than the concurrency limit", func() {
+			It("Then only the limit should run at a time", func() {
+				data := []map[string]string{}
+				for i := 0; i < 6; i++ {
+					data = append(data, map[string]string{ExecCommandKey: "sleep 0.2"})
+				}
+				update = make(chan StatusUpdate, len(data))
+				start := time.Now()
+				newProbe(&ExecProbeConfig{maxConcurrent: 2}, data...).probe()
+				Expect(time.Since(start)).To(BeNumerically(">=", 600*time.Millisecond))
+				Expect(update).To(HaveLen(6))
+			})
+		})
+		Context("When several probes have more commands than can run at a time on the host", func() {
+			It("Then only the host limit should run at a time", func() {
+				Expect(setExecMaxConcurrent(2)).To(Succeed())
+				defer setExecMaxConcurrent(defaultExecMaxConcurrent)
+				data := []map[string]string{
+					{ExecCommandKey: "sleep 0.2"},
+					{ExecCommandKey: "sleep 0.2"},
+				}
+				probes := []*ExecProbe{
+					newProbe(&ExecProbeConfig{maxConcurrent: 2}, data...),
+					newProbe(&ExecProbeConfig{maxConcurrent: 2}, data...),
+				}
+				start := time.Now()
+				done := make(chan bool)
+				for _, ep := range probes {
+					go func(ep *ExecProbe) {
+						ep.probe()
+						done <- true
+					}(ep)
+				}
+				<-done
+				<-done
+				Expect(time.Since(start)).To(BeNumerically(">=", 400*time.Millisecond))
+				Expect(update).To(HaveLen(4))
+				Expect(setExecMaxConcurrent(0)).ToNot(Succeed())
+			})
+		})
+		Context("When the probe data is invalid", func() {
+			It("Then it should error on initialize", func() {
+				statuses := func(data map[string]string) []*Status {
+					return []*Status{{ID: "check", Probe: ProbeRef{RefID: "exec", Data: data}}}
+				}
+				ep := NewExecProbe(&ExecProbeConfig{id: "exec"})
+				Expect(ep.Initialize(statuses(map[string]string{}))).ToNot(BeNil())
+				Expect(ep.Initialize(statuses(map[string]string{ExecCommandKey: "true", ExecOutputKey: "title"}))).ToNot(BeNil())
+				Expect(ep.Initialize(statuses(map[string]string{ExecCommandKey: "true", ExecTimeoutKey: "soon"}))).ToNot(BeNil())
+			})
+		})
+	})
+})
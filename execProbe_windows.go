@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os/exec"
+)
+
+// newShellCommand runs the command with cmd
+func newShellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+// killCommand kills a started command. Processes it started are not killed
+func killCommand(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+const (
+	GRPCHealthType                  = "GRPCHealth"
+	GRPCHealthIntervalKey           = "interval"
+	GRPCHealthAddressKey            = "address"
+	GRPCHealthServiceKey            = "service"
+	GRPCHealthTimeoutKey            = "timeout"
+	GRPCHealthWatchKey              = "watch"
+	GRPCHealthTLSKey                = "tls"
+	GRPCHealthServerNameKey         = "serverName"
+	GRPCHealthCAFileKey             = "caFile"
+	GRPCHealthInsecureSkipVerifyKey = "insecureSkipVerify"
+	defaultGRPCHealthTimeout        = 5 * time.Second
+)
+
+var (
+	// grpcHealthStatuses maps the serving status of the health protocol to statuses
+	grpcHealthStatuses = map[healthpb.HealthCheckResponse_ServingStatus]StatusValue{
+		healthpb.HealthCheckResponse_SERVING:         StatusGood,
+		healthpb.HealthCheckResponse_NOT_SERVING:     StatusBad,
+		healthpb.HealthCheckResponse_UNKNOWN:         StatusUnknown,
+		healthpb.HealthCheckResponse_SERVICE_UNKNOWN: StatusUnknown,
+	}
+)
+
+// GRPCHealthProbeConfig is the configuration for a grpc health probe
+type GRPCHealthProbeConfig struct {
+	id       string
+	update   chan StatusUpdate
+	health   chan ProbeReport
+	interval time.Duration
+}
+
+// GRPCHealthProbe is a probe that uses the grpc health checking protocol. Statuses are polled with Check
+// on the interval or get every change as it happens with Watch
+type GRPCHealthProbe struct {
+	refID    string
+	update   chan StatusUpdate
+	health   chan ProbeReport
+	interval time.Duration
+	ticker   *time.Ticker
+	stopChan chan bool
+	watches  sync.WaitGroup
+	checks   []*grpcHealthCheck
+}
+
+// grpcHealthCheck is a single service check belonging to a status
+type grpcHealthCheck struct {
+	statusID    string
+	address     string
+	service     string // the whole server if empty
+	timeout     time.Duration
+	watch       bool
+	credentials credentials.TransportCredentials
+	client      healthpb.HealthClient // set while the probe is running
+}
+
+func init() {
+	RegisterProbeFactory(ProbeFactory{
+		Type:            GRPCHealthType,
+		RequiredDefKeys: []string{GRPCHealthIntervalKey},
+		RequiredRefKeys: []string{GRPCHealthAddressKey},
+		New:             newGRPCHealthProbeFromConfig,
+	})
+}
+
+// newGRPCHealthProbeFromConfig creates and initializes a grpc health probe for the probe registry
+func newGRPCHealthProbeFromConfig(config ProbeConfig, statuses []*Status) (Probe, error) {
+	gp := NewGRPCHealthProbe(&GRPCHealthProbeConfig{
+		id:       config.ID,
+		update:   config.Update,
+		health:   config.Health,
+		interval: config.Interval,
+	})
+	err := gp.Initialize(statuses)
+	if err != nil {
+		return nil, err
+	}
+	return gp, nil
+}
+
+// NewGRPCHealthProbe returns a grpc health probe
+func NewGRPCHealthProbe(config *GRPCHealthProbeConfig) *GRPCHealthProbe {
+	return &GRPCHealthProbe{
+		refID:    config.id,
+		update:   config.update,
+		health:   config.health,
+		interval: config.interval,
+		stopChan: make(chan bool),
+		checks:   []*grpcHealthCheck{},
+	}
+}
+
+// Initialize parses through all status to find which services need to be checked
+func (gp *GRPCHealthProbe) Initialize(statuses []*Status) error {
+	return forEachProbeRef(gp.refID, statuses, func(fullStatusID string, s *Status) error {
+		check, err := newGRPCHealthCheck(fullStatusID, s)
+		if err != nil {
+			return err
+		}
+		gp.checks = append(gp.checks, check)
+		return nil
+	})
+}
+
+// Start connects to the servers, starts watching the statuses with watch set and polls the rest at the given interval
+func (gp *GRPCHealthProbe) Start() {
+	if gp.ticker == nil {
+		logger.Debug("Starting gRPC Health Probe", "refID", gp.refID)
+		conns := []*grpc.ClientConn{}
+		for _, c := range gp.checks {
+			// connections are made in the background and retried so this only fails on invalid options
+			conn, err := grpc.Dial(c.address, grpc.WithTransportCredentials(c.credentials))
+			if err != nil {
+				logger.Error("Could not create gRPC connection", "refID", gp.refID, "address", c.address, "error", err)
+				continue
+			}
+			conns = append(conns, conn)
+			c.client = healthpb.NewHealthClient(conn)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		for _, c := range gp.checks {
+			if c.watch && c.client != nil {
+				gp.watches.Add(1)
+				go gp.watch(ctx, c)
+			}
+		}
+
+		gp.ticker = time.NewTicker(gp.interval)
+		gp.probe()
+		for {
+			select {
+			case <-gp.ticker.C:
+				gp.probe()
+			case <-gp.stopChan:
+				gp.ticker.Stop()
+				gp.ticker = nil
+				cancel()
+				gp.watches.Wait()
+				for _, conn := range conns {
+					conn.Close()
+				}
+				logger.Debug("Exiting gRPC Health Probe", "refID", gp.refID)
+				return
+			}
+		}
+	}
+}
+
+// Stop stops checking services and closes the connections
+func (gp *GRPCHealthProbe) Stop() {
+	gp.stopChan <- true
+}
+
+// probe polls the checks not being watched concurrently. Servers which cannot be reached are reported
+// as bad statuses so the probe itself always reports healthy
+func (gp *GRPCHealthProbe) probe() {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, check := range gp.checks {
+		if check.watch && check.client != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(c *grpcHealthCheck) {
+			defer wg.Done()
+			status, message := gp.runCheck(c)
+			gp.update <- StatusUpdate{
+				ID:      c.statusID,
+				Status:  status,
+				Source:  gp.refID,
+				Message: message,
+			}
+		}(check)
+	}
+	wg.Wait()
+	reportProbeHealth(gp.health, gp.refID, start, nil)
+}
+
+// runCheck calls Check and returns the status of the serving status. A service the server does not know is unknown
+// and a server which cannot be reached is bad
+func (gp *GRPCHealthProbe) runCheck(c *grpcHealthCheck) (StatusValue, string) {
+	if c.client == nil {
+		return StatusBad, "no connection to " + c.address
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	resp, err := c.client.Check(ctx, &healthpb.HealthCheckRequest{Service: c.service})
+	if err != nil {
+		logger.Debug("gRPC health check failed", "refID", gp.refID, "address", c.address, "service", c.service, "error", err)
+		if grpcstatus.Code(err) == codes.NotFound {
+			return StatusUnknown, grpcstatus.Convert(err).Message()
+		}
+		return StatusBad, err.Error()
+	}
+	return grpcHealthStatuses[resp.Status], resp.Status.String()
+}
+
+// watch sends an update for every change of the serving status until the context is done. If the stream breaks
+// the status is bad and the stream is opened again after the interval. Servers which do not implement Watch are polled instead
+func (gp *GRPCHealthProbe) watch(ctx context.Context, c *grpcHealthCheck) {
+	defer gp.watches.Done()
+	for {
+		err := gp.watchUntilError(ctx, c)
+		if ctx.Err() != nil {
+			return
+		}
+		if grpcstatus.Code(err) == codes.Unimplemented {
+			logger.Warning("gRPC server cannot be watched, polling it instead", "refID", gp.refID, "address", c.address, "service", c.service)
+			gp.poll(ctx, c)
+			return
+		}
+		logger.Debug("gRPC health watch failed", "refID", gp.refID, "address", c.address, "service", c.service, "error", err)
+		select {
+		case gp.update <- StatusUpdate{ID: c.statusID, Status: StatusBad, Source: gp.refID, Message: err.Error()}:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-time.After(gp.interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// poll checks the service every interval until the context is done
+func (gp *GRPCHealthProbe) poll(ctx context.Context, c *grpcHealthCheck) {
+	ticker := time.NewTicker(gp.interval)
+	defer ticker.Stop()
+	for {
+		status, message := gp.runCheck(c)
+		select {
+		case gp.update <- StatusUpdate{ID: c.statusID, Status: status, Source: gp.refID, Message: message}:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watchUntilError sends an update for every serving status received until the stream breaks. The last serving status
+// is sent again every interval so the status is not marked stale while nothing changes
+func (gp *GRPCHealthProbe) watchUntilError(ctx context.Context, c *grpcHealthCheck) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.client.Watch(ctx, &healthpb.HealthCheckRequest{Service: c.service})
+	if err != nil {
+		return err
+	}
+	responses := make(chan *healthpb.HealthCheckResponse)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case responses <- resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(gp.interval)
+	defer ticker.Stop()
+	var last *StatusUpdate
+	for {
+		select {
+		case resp := <-responses:
+			last = &StatusUpdate{ID: c.statusID, Status: grpcHealthStatuses[resp.Status], Source: gp.refID, Message: resp.Status.String()}
+		case <-ticker.C:
+			if last == nil {
+				continue
+			}
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case gp.update <- *last:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func newGRPCHealthCheck(fullStatusID string, s *Status) (*grpcHealthCheck, error) {
+	data := s.Probe.Data
+	invalid := func(key string, err error) error {
+		return fmt.Errorf("%s has invalid '%s' for GRPCHealth probe: %s", s.FullName, key, err.Error())
+	}
+	if data[GRPCHealthAddressKey] == "" {
+		return nil, fmt.Errorf("%s is missing '%s' field in 'data' for GRPCHealth probe", s.FullName, GRPCHealthAddressKey)
+	}
+	host, _, err := net.SplitHostPort(data[GRPCHealthAddressKey])
+	if err != nil {
+		return nil, invalid(GRPCHealthAddressKey, err)
+	}
+
+	timeout := defaultGRPCHealthTimeout
+	if data[GRPCHealthTimeoutKey] != "" {
+		timeout, err = time.ParseDuration(data[GRPCHealthTimeoutKey])
+		if err != nil {
+			return nil, invalid(GRPCHealthTimeoutKey, err)
+		}
+	}
+	flags := map[string]bool{}
+	for _, key := range []string{GRPCHealthWatchKey, GRPCHealthTLSKey, GRPCHealthInsecureSkipVerifyKey} {
+		if data[key] == "" {
+			continue
+		}
+		flags[key], err = strconv.ParseBool(data[key])
+		if err != nil {
+			return nil, invalid(key, err)
+		}
+	}
+
+	creds := insecure.NewCredentials()
+	if flags[GRPCHealthTLSKey] {
+		serverName := data[GRPCHealthServerNameKey]
+		if serverName == "" {
+			serverName = host
+		}
+		config := &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: flags[GRPCHealthInsecureSkipVerifyKey],
+		}
+		if data[GRPCHealthCAFileKey] != "" {
+			config.RootCAs, err = loadCertPool(data[GRPCHealthCAFileKey])
+			if err != nil {
+				return nil, invalid(GRPCHealthCAFileKey, err)
+			}
+		}
+		creds = credentials.NewTLS(config)
+	}
+	return &grpcHealthCheck{
+		statusID:    fullStatusID,
+		address:     data[GRPCHealthAddressKey],
+		service:     data[GRPCHealthServiceKey],
+		timeout:     timeout,
+		watch:       flags[GRPCHealthWatchKey],
+		credentials: creds,
+	}, nil
+}
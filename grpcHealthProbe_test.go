@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// checkOnlyHealthServer answers Check but does not implement Watch like some servers
+type checkOnlyHealthServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (checkOnlyHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+var _ = Describe("GRPCHealthProbe", func() {
+	var healthServer *health.Server
+	var healthService healthpb.HealthServer // served by serve
+	var servers []*grpc.Server
+	var update chan StatusUpdate
+
+	BeforeEach(func() {
+		update = make(chan StatusUpdate, 10)
+		healthServer = health.NewServer()
+		healthServer.SetServingStatus("api", healthpb.HealthCheckResponse_SERVING)
+		healthService = healthServer
+		servers = []*grpc.Server{}
+	})
+
+	AfterEach(func() {
+		for _, s := range servers {
+			s.Stop()
+		}
+	})
+
+	// serve starts a grpc server with the health service and returns its address
+	serve := func(opts ...grpc.ServerOption) string {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		s := grpc.NewServer(opts...)
+		healthpb.RegisterHealthServer(s, healthService)
+		servers = append(servers, s)
+		go s.Serve(l)
+		return l.Addr().String()
+	}
+
+	newProbe := func(data map[string]string) *GRPCHealthProbe {
+		gp := NewGRPCHealthProbe(&GRPCHealthProbeConfig{id: "grpc", update: update, interval: time.Minute})
+		Expect(gp.Initialize([]*Status{{ID: "api", Probe: ProbeRef{RefID: "grpc", Data: data}}})).To(Succeed())
+		return gp
+	}
+
+	// check starts the probe, waits for the first update and stops it again
+	check := func(data map[string]string) StatusUpdate {
+		gp := newProbe(data)
+		go gp.Start()
+		defer gp.Stop()
+		return <-update
+	}
+
+	Describe("Given a status referencing a GRPCHealth probe", func() {
+		Context("When the service is checked", func() {
+			It("Then the serving status should map to the status", func() {
+				address := serve()
+				Expect(check(map[string]string{GRPCHealthAddressKey: address, GRPCHealthServiceKey: "api"})).To(Equal(StatusUpdate{
+					ID:      "api",
+					Status:  StatusGood,
+					Source:  "grpc",
+					Message: "SERVING",
+				}))
+				healthServer.SetServingStatus("api", healthpb.HealthCheckResponse_NOT_SERVING)
+				Expect(check(map[string]string{GRPCHealthAddressKey: address, GRPCHealthServiceKey: "api"}).Status).To(Equal(StatusBad))
+				healthServer.SetServingStatus("api", healthpb.HealthCheckResponse_UNKNOWN)
+				Expect(check(map[string]string{GRPCHealthAddressKey: address, GRPCHealthServiceKey: "api"}).Status).To(Equal(StatusUnknown))
+			})
+			It("Then a service the server does not know should be unknown", func() {
+				su := check(map[string]string{GRPCHealthAddressKey: serve(), GRPCHealthServiceKey: "billing"})
+				Expect(su.Status).To(Equal(StatusUnknown))
+				Expect(su.Message).To(Equal("unknown service"))
+			})
+			It("Then a server which cannot be reached should be bad", func() {
+				l, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).To(BeNil())
+				address := l.Addr().String()
+				l.Close()
+				su := check(map[string]string{GRPCHealthAddressKey: address, GRPCHealthTimeoutKey: "200ms"})
+				Expect(su.Status).To(Equal(StatusBad))
+				Expect(su.Message).To(ContainSubstring("Unavailable"))
+			})
+		})
+		Context("When the service is watched", func() {
+			It("Then every change should be sent as it happens", func() {
+				gp := newProbe(map[string]string{GRPCHealthAddressKey: serve(), GRPCHealthServiceKey: "api", GRPCHealthWatchKey: "true"})
+				go gp.Start()
+				defer gp.Stop()
+				Eventually(update).Should(Receive(Equal(StatusUpdate{ID: "api", Status: StatusGood, Source: "grpc", Message: "SERVING"})))
+				healthServer.SetServingStatus("api", healthpb.HealthCheckResponse_NOT_SERVING)
+				Eventually(update).Should(Receive(Equal(StatusUpdate{ID: "api", Status: StatusBad, Source: "grpc", Message: "NOT_SERVING"})))
+				healthServer.SetServingStatus("api", healthpb.HealthCheckResponse_SERVING)
+				Eventually(update).Should(Receive(Equal(StatusUpdate{ID: "api", Status: StatusGood, Source: "grpc", Message: "SERVING"})))
+			})
+			It("Then the last status should be sent again every interval", func() {
+				gp := NewGRPCHealthProbe(&GRPCHealthProbeConfig{id: "grpc", update: update, interval: 100 * time.Millisecond})
+				Expect(gp.Initialize([]*Status{{ID: "api", Probe: ProbeRef{RefID: "grpc", Data: map[string]string{GRPCHealthAddressKey: serve(), GRPCHealthServiceKey: "api", GRPCHealthWatchKey: "true"}}}})).To(Succeed())
+				go gp.Start()
+				defer gp.Stop()
+				serving := StatusUpdate{ID: "api", Status: StatusGood, Source: "grpc", Message: "SERVING"}
+				Eventually(update).Should(Receive(Equal(serving)))
+				Eventually(update).Should(Receive(Equal(serving)))
+				Eventually(update).Should(Receive(Equal(serving)))
+			})
+			It("Then a server which cannot be watched should be polled instead", func() {
+				healthService = checkOnlyHealthServer{}
+				gp := NewGRPCHealthProbe(&GRPCHealthProbeConfig{id: "grpc", update: update, interval: 100 * time.Millisecond})
+				Expect(gp.Initialize([]*Status{{ID: "api", Probe: ProbeRef{RefID: "grpc", Data: map[string]string{GRPCHealthAddressKey: serve(), GRPCHealthServiceKey: "api", GRPCHealthWatchKey: "true"}}}})).To(Succeed())
+				go gp.Start()
+				defer gp.Stop()
+				serving := StatusUpdate{ID: "api", Status: StatusGood, Source: "grpc", Message: "SERVING"}
+				for i := 0; i < 3; i++ {
+					var su StatusUpdate
+					Eventually(update).Should(Receive(&su))
+					Expect(su).To(Equal(serving))
+				}
+			})
+			It("Then the status should be bad when the server goes away", func() {
+				gp := newProbe(map[string]string{GRPCHealthAddressKey: serve(), GRPCHealthServiceKey: "api", GRPCHealthWatchKey: "true"})
+				go gp.Start()
+				defer gp.Stop()
+				var su StatusUpdate
+				Eventually(update).Should(Receive(&su))
+				Expect(su.Status).To(Equal(StatusGood))
+				servers[0].Stop()
+				Eventually(update).Should(Receive(&su))
+				Expect(su.Status).To(Equal(StatusBad))
+			})
+		})
+		Context("When the server uses TLS", func() {
+			It("Then the certificate should be verified with the CA file", func() {
+				now := time.Now()
+				ca := newTestCert(nil, true, now.Add(-time.Hour), now.Add(time.Hour))
+				leaf := newTestCert(ca, false, now.Add(-time.Hour), now.Add(time.Hour))
+				creds := credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.der, ca.der}, PrivateKey: leaf.key}}})
+				address := serve(grpc.Creds(creds))
+
+				dir, err := ioutil.TempDir("", "grpchealth")
+				Expect(err).To(BeNil())
+				defer os.RemoveAll(dir)
+				caFile := filepath.Join(dir, "ca.pem")
+				Expect(ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.der}), 0600)).To(Succeed())
+
+				Expect(check(map[string]string{GRPCHealthAddressKey: address, GRPCHealthTLSKey: "true", GRPCHealthCAFileKey: caFile}).Status).To(Equal(StatusGood))
+				Expect(check(map[string]string{GRPCHealthAddressKey: address, GRPCHealthTLSKey: "true", GRPCHealthInsecureSkipVerifyKey: "true"}).Status).To(Equal(StatusGood))
+				Expect(check(map[string]string{GRPCHealthAddressKey: address, GRPCHealthTLSKey: "true", GRPCHealthTimeoutKey: "500ms"}).Status).To(Equal(StatusBad))
+			})
+		})
+		Context("When the probe data is invalid", func() {
+			It("Then it should error on initialize", func() {
+				statuses := func(data map[string]string) []*Status {
+					return []*Status{{ID: "api", Probe: ProbeRef{RefID: "grpc", Data: data}}}
+				}
+				gp := NewGRPCHealthProbe(&GRPCHealthProbeConfig{id: "grpc"})
+				Expect(gp.Initialize(statuses(map[string]string{}))).ToNot(BeNil())
+				Expect(gp.Initialize(statuses(map[string]string{GRPCHealthAddressKey: "localhost"}))).ToNot(BeNil())
+				Expect(gp.Initialize(statuses(map[string]string{GRPCHealthAddressKey: "localhost:50051", GRPCHealthWatchKey: "yes please"}))).ToNot(BeNil())
+				Expect(gp.Initialize(statuses(map[string]string{GRPCHealthAddressKey: "localhost:50051", GRPCHealthTimeoutKey: "soon"}))).ToNot(BeNil())
+				Expect(gp.Initialize(statuses(map[string]string{GRPCHealthAddressKey: "localhost:50051", GRPCHealthTLSKey: "true", GRPCHealthCAFileKey: "/does/not/exist.pem"}))).ToNot(BeNil())
+			})
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHistorySize = 1000
+
+	apiSource    = "api"
+	rollupSource = "rollup"
+	staleSource  = "stale"
+)
+
+// Transition is a change of a status from one value to another
+type Transition struct {
+	ID        string      `json:"id"`
+	Old       StatusValue `json:"old"`
+	New       StatusValue `json:"new"`
+	Source    string      `json:"source,omitempty"` // probe id, api or rollup
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// HistoryStore keeps the transitions of every status
+type HistoryStore interface {
+	// Record stores a transition
+	Record(t Transition) error
+	// Query returns the transitions of a status between since and until (inclusive) oldest first
+	Query(id string, since, until time.Time) ([]Transition, error)
+	// Close releases anything held by the store
+	Close() error
+}
+
+// MemoryHistory keeps the most recent transitions of every status in memory
+type MemoryHistory struct {
+	lock        sync.RWMutex
+	size        int
+	transitions map[string][]Transition // key: full status id
+}
+
+// NewMemoryHistory returns a history that keeps up to size transitions per status
+func NewMemoryHistory(size int) *MemoryHistory {
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	return &MemoryHistory{
+		size:        size,
+		transitions: map[string][]Transition{},
+	}
+}
+
+// Record stores a transition dropping the oldest one of the status if full
+func (mh *MemoryHistory) Record(t Transition) error {
+	mh.lock.Lock()
+	defer mh.lock.Unlock()
+	transitions := append(mh.transitions[t.ID], t)
+	if len(transitions) > mh.size {
+		transitions = transitions[len(transitions)-mh.size:]
+	}
+	mh.transitions[t.ID] = transitions
+	return nil
+}
+
+// Query returns the transitions of a status between since and until
+func (mh *MemoryHistory) Query(id string, since, until time.Time) ([]Transition, error) {
+	mh.lock.RLock()
+	defer mh.lock.RUnlock()
+	return filterTransitions(mh.transitions[id], since, until), nil
+}
+
+// Close does nothing for memory history
+func (mh *MemoryHistory) Close() error {
+	return nil
+}
+
+// filterTransitions returns the transitions between since and until sorted oldest first
+func filterTransitions(transitions []Transition, since, until time.Time) []Transition {
+	filtered := []Transition{}
+	for _, t := range transitions {
+		if t.Timestamp.Before(since) || t.Timestamp.After(until) {
+			continue
+		}
+		filtered = append(filtered, t)
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].Timestamp.Before(filtered[j].Timestamp)
+	})
+	return filtered
+}
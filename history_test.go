@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("History", func() {
+	start := time.Date(2018, 4, 10, 0, 0, 0, 0, time.UTC)
+	transition := func(minutes int, new StatusValue) Transition {
+		return Transition{ID: "prod#service1", Old: StatusGood, New: new, Source: "probe", Timestamp: start.Add(time.Duration(minutes) * time.Minute)}
+	}
+
+	// both stores should behave the same
+	behavesLikeAHistoryStore := func(newStore func() HistoryStore) {
+		var store HistoryStore
+		BeforeEach(func() {
+			store = newStore()
+		})
+		AfterEach(func() {
+			store.Close()
+		})
+		Context("When transitions are queried by time", func() {
+			It("Then only the transitions in the range should be returned oldest first", func() {
+				Expect(store.Record(transition(10, StatusBad))).To(Succeed())
+				Expect(store.Record(transition(0, StatusDegraded))).To(Succeed())
+				Expect(store.Record(transition(20, StatusGood))).To(Succeed())
+				Expect(store.Record(Transition{ID: "other", New: StatusBad, Timestamp: start})).To(Succeed())
+
+				transitions, err := store.Query("prod#service1", start.Add(5*time.Minute), start.Add(20*time.Minute))
+				Expect(err).To(BeNil())
+				Expect(transitions).To(HaveLen(2))
+				Expect(transitions[0].New).To(Equal(StatusBad))
+				Expect(transitions[1].New).To(Equal(StatusGood))
+
+				transitions, err = store.Query("prod#service1", time.Time{}, time.Now())
+				Expect(err).To(BeNil())
+				Expect(transitions).To(HaveLen(3))
+				Expect(transitions[0].Timestamp.Equal(start)).To(BeTrue())
+			})
+		})
+		Context("When a status has no transitions", func() {
+			It("Then nothing should be returned", func() {
+				transitions, err := store.Query("nothing", time.Time{}, time.Now())
+				Expect(err).To(BeNil())
+				Expect(transitions).To(BeEmpty())
+			})
+		})
+	}
+
+	Describe("Given a memory history", func() {
+		behavesLikeAHistoryStore(func() HistoryStore {
+			return NewMemoryHistory(10)
+		})
+		Context("When more transitions than its size are recorded", func() {
+			It("Then the oldest should be dropped", func() {
+				store := NewMemoryHistory(2)
+				for i := 0; i < 3; i++ {
+					store.Record(transition(i, StatusBad))
+				}
+				transitions, _ := store.Query("prod#service1", time.Time{}, time.Now())
+				Expect(transitions).To(Equal([]Transition{transition(1, StatusBad), transition(2, StatusBad)}))
+			})
+		})
+	})
+
+	Describe("Given a bolt history", func() {
+		var dir string
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "history")
+			Expect(err).To(BeNil())
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+		behavesLikeAHistoryStore(func() HistoryStore {
+			store, err := NewBoltHistory(filepath.Join(dir, "history.db"))
+			Expect(err).To(BeNil())
+			return store
+		})
+		Context("When the file is reopened", func() {
+			It("Then the transitions should still be there", func() {
+				path := filepath.Join(dir, "reopen.db")
+				store, err := NewBoltHistory(path)
+				Expect(err).To(BeNil())
+				Expect(store.Record(transition(0, StatusBad))).To(Succeed())
+				Expect(store.Record(transition(0, StatusGood))).To(Succeed())
+				store.Close()
+
+				store, err = NewBoltHistory(path)
+				Expect(err).To(BeNil())
+				defer store.Close()
+				transitions, err := store.Query("prod#service1", start, start)
+				Expect(err).To(BeNil())
+				Expect(transitions).To(HaveLen(2))
+			})
+		})
+	})
+
+	Describe("Given a Monitor", func() {
+		var router *mux.Router
+		var m *Monitor
+		BeforeEach(func() {
+			router = mux.NewRouter()
+			m = NewMonitor(&MonitorConfig{
+				Router:   router,
+				Statuses: []*Status{{ID: "prod", Rollup: &Rollup{Mode: RollupWorst}, Children: []*Status{{ID: "service1", Status: StatusGood}}}},
+			})
+		})
+		getHistory := func(id, query string) (*httptest.ResponseRecorder, StatusHistory) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/status/"+url.PathEscape(id)+"/history"+query, nil)
+			r.SetBasicAuth("", "")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			var history StatusHistory
+			json.Unmarshal(w.Body.Bytes(), &history)
+			return w, history
+		}
+		Context("When a status changes", func() {
+			It("Then the transition should be in its history along with the roll-up parent", func() {
+				Expect(m.UpdateStatusByID(StatusUpdate{ID: "prod#service1", Status: StatusBad, Source: "probe"})).To(Succeed())
+				Expect(m.UpdateStatusByID(StatusUpdate{ID: "prod#service1", Status: StatusBad, Source: "probe"})).To(Succeed())
+
+				w, history := getHistory("prod#service1", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(history.Transitions).To(HaveLen(1))
+				Expect(history.Transitions[0].Old).To(Equal(StatusGood))
+				Expect(history.Transitions[0].New).To(Equal(StatusBad))
+				Expect(history.Transitions[0].Source).To(Equal("probe"))
+
+				_, history = getHistory("prod", "")
+				Expect(history.Transitions).To(HaveLen(1))
+				Expect(history.Transitions[0].Source).To(Equal(rollupSource))
+			})
+		})
+		Context("When the history is asked for a time range", func() {
+			It("Then only transitions in the range should be returned", func() {
+				Expect(m.UpdateStatusByID(StatusUpdate{ID: "prod#service1", Status: StatusBad})).To(Succeed())
+				_, history := getHistory("prod#service1", "?since="+url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))+"&until="+url.QueryEscape(time.Now().Add(2*time.Hour).Format(time.RFC3339)))
+				Expect(history.Transitions).To(BeEmpty())
+			})
+		})
+		Context("When the request is invalid", func() {
+			It("Then it should error", func() {
+				w, _ := getHistory("prod#service2", "")
+				Expect(w.Code).To(Equal(http.StatusNotFound))
+				w, _ = getHistory("prod#service1", "?since=yesterday")
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+})
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HTTPType               = "HTTP"
+	HTTPIntervalKey        = "interval"
+	HTTPTimeoutKey         = "timeout"
+	HTTPURLKey             = "url"
+	HTTPExpectedStatusKey  = "expectedStatus"
+	HTTPBodyContainsKey    = "bodyContains"
+	HTTPBodyRegexKey       = "bodyRegex"
+	defaultHTTPTimeout     = 10 * time.Second
+	defaultHTTPStatusCodes = "200"
+	maxHTTPBodySize        = 1 << 20 // only read the first 1MB of a body when matching
+
+	MissingURLKey = "%s is missing 'url' field in 'data' for HTTP probe"
+)
+
+// HTTPProbeConfig is the configuration for a http probe
+type HTTPProbeConfig struct {
+	id       string
+	update   chan StatusUpdate
+	health   chan ProbeReport
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// HTTPProbe is a probe that makes http requests to urls and checks the response
+type HTTPProbe struct {
+	refID    string
+	update   chan StatusUpdate
+	health   chan ProbeReport
+	interval time.Duration
+	timeout  time.Duration
+	ticker   *time.Ticker
+	stopChan chan bool
+	client   *http.Client
+	checks   []*httpCheck
+}
+
+// httpCheck is a single url check belonging to a status
+type httpCheck struct {
+	statusID      string
+	url           string
+	expectedCodes []int
+	bodyContains  string
+	bodyRegex     *regexp.Regexp
+	timeout       time.Duration
+}
+
+func init() {
+	RegisterProbeFactory(ProbeFactory{
+		Type:            HTTPType,
+		RequiredDefKeys: []string{HTTPIntervalKey},
+		RequiredRefKeys: []string{HTTPURLKey},
+		New:             newHTTPProbeFromConfig,
+	})
+}
+
+// newHTTPProbeFromConfig creates and initializes a http probe for the probe registry
+func newHTTPProbeFromConfig(config ProbeConfig, statuses []*Status) (Probe, error) {
+	var timeout time.Duration
+	if config.Data[HTTPTimeoutKey] != "" {
+		var err error
+		timeout, err = time.ParseDuration(config.Data[HTTPTimeoutKey])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %s", HTTPTimeoutKey, err.Error())
+		}
+	}
+	hp := NewHTTPProbe(&HTTPProbeConfig{
+		id:       config.ID,
+		update:   config.Update,
+		health:   config.Health,
+		interval: config.Interval,
+		timeout:  timeout,
+	})
+	err := hp.Initialize(statuses)
+	if err != nil {
+		return nil, err
+	}
+	return hp, nil
+}
+
+// NewHTTPProbe returns a http probe
+func NewHTTPProbe(config *HTTPProbeConfig) *HTTPProbe {
+	timeout := config.timeout
+	if timeout == 0 {
+		timeout = defaultHTTPTimeout
+	}
+	return &HTTPProbe{
+		refID:    config.id,
+		update:   config.update,
+		health:   config.health,
+		interval: config.interval,
+		timeout:  timeout,
+		stopChan: make(chan bool),
+		client:   &http.Client{},
+		checks:   []*httpCheck{},
+	}
+}
+
+// Initialize parses through all status to find which ones needs to be checked via http
+func (hp *HTTPProbe) Initialize(statuses []*Status) error {
+	return forEachProbeRef(hp.refID, statuses, func(fullStatusID string, s *Status) error {
+		check, err := hp.newCheck(fullStatusID, s)
+		if err != nil {
+			return err
+		}
+		hp.checks = append(hp.checks, check)
+		return nil
+	})
+}
+
+// Start begins checking all urls at the given interval
+func (hp *HTTPProbe) Start() {
+	if hp.ticker == nil {
+		logger.Debug("Starting HTTP Probe", "refID", hp.refID)
+		hp.ticker = time.NewTicker(hp.interval)
+		hp.probe()
+		for {
+			select {
+			case <-hp.ticker.C:
+				hp.probe()
+			case <-hp.stopChan:
+				hp.ticker.Stop()
+				hp.ticker = nil
+				logger.Debug("Exiting HTTP Probe", "refID", hp.refID)
+				return
+			}
+		}
+	}
+}
+
+// Stop stops checking urls
+func (hp *HTTPProbe) Stop() {
+	hp.stopChan <- true
+}
+
+// probe runs all checks concurrently so one slow url does not hold up the others.
+// Failing urls are reported as bad statuses so the probe itself always reports healthy
+func (hp *HTTPProbe) probe() {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, check := range hp.checks {
+		wg.Add(1)
+		go func(c *httpCheck) {
+			defer wg.Done()
+			status, message := hp.runCheck(c)
+			hp.update <- StatusUpdate{
+				ID:      c.statusID,
+				Status:  status,
+				Source:  hp.refID,
+				Message: message,
+			}
+		}(check)
+	}
+	wg.Wait()
+	reportProbeHealth(hp.health, hp.refID, start, nil)
+}
+
+// runCheck requests the url and returns bad if the request fails or the status code is unexpected
+// and degraded if the body does not match, along with why or the status of the response if it is good
+func (hp *HTTPProbe) runCheck(c *httpCheck) (StatusValue, string) {
+	client := *hp.client
+	client.Timeout = c.timeout
+	resp, err := client.Get(c.url)
+	if err != nil {
+		logger.Debug("HTTP check failed", "refID", hp.refID, "url", c.url, "error", err)
+		return StatusBad, err.Error()
+	}
+	defer resp.Body.Close()
+
+	if !containsCode(c.expectedCodes, resp.StatusCode) {
+		logger.Debug("HTTP check got unexpected status code", "refID", hp.refID, "url", c.url, "status code", resp.StatusCode)
+		return StatusBad, "unexpected status " + resp.Status
+	}
+	if c.bodyContains == "" && c.bodyRegex == nil {
+		return StatusGood, resp.Status
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxHTTPBodySize))
+	if err != nil {
+		logger.Debug("HTTP check could not read body", "refID", hp.refID, "url", c.url, "error", err)
+		return StatusBad, err.Error()
+	}
+	if c.bodyContains != "" && !strings.Contains(string(body), c.bodyContains) {
+		return StatusDegraded, fmt.Sprintf("body does not contain '%s'", c.bodyContains)
+	}
+	if c.bodyRegex != nil && !c.bodyRegex.Match(body) {
+		return StatusDegraded, fmt.Sprintf("body does not match '%s'", c.bodyRegex.String())
+	}
+	return StatusGood, resp.Status
+}
+
+func (hp *HTTPProbe) newCheck(fullStatusID string, s *Status) (*httpCheck, error) {
+	data := s.Probe.Data
+	if data[HTTPURLKey] == "" {
+		return nil, fmt.Errorf(MissingURLKey, s.FullName)
+	}
+
+	codes := data[HTTPExpectedStatusKey]
+	if codes == "" {
+		codes = defaultHTTPStatusCodes
+	}
+	expectedCodes, err := parseStatusCodes(codes)
+	if err != nil {
+		return nil, fmt.Errorf("%s has invalid '%s' for HTTP probe: %s", s.FullName, HTTPExpectedStatusKey, err.Error())
+	}
+
+	timeout := hp.timeout
+	if data[HTTPTimeoutKey] != "" {
+		timeout, err = time.ParseDuration(data[HTTPTimeoutKey])
+		if err != nil {
+			return nil, fmt.Errorf("%s has invalid '%s' for HTTP probe: %s", s.FullName, HTTPTimeoutKey, err.Error())
+		}
+	}
+
+	var bodyRegex *regexp.Regexp
+	if data[HTTPBodyRegexKey] != "" {
+		bodyRegex, err = regexp.Compile(data[HTTPBodyRegexKey])
+		if err != nil {
+			return nil, fmt.Errorf("%s has invalid '%s' for HTTP probe: %s", s.FullName, HTTPBodyRegexKey, err.Error())
+		}
+	}
+
+	return &httpCheck{
+		statusID:      fullStatusID,
+		url:           data[HTTPURLKey],
+		expectedCodes: expectedCodes,
+		bodyContains:  data[HTTPBodyContainsKey],
+		bodyRegex:     bodyRegex,
+		timeout:       timeout,
+	}, nil
+}
+
+// parseStatusCodes parses a comma delimited list of status codes like "200,204"
+func parseStatusCodes(codes string) ([]int, error) {
+	expectedCodes := []int{}
+	for _, code := range strings.Split(codes, ",") {
+		c, err := strconv.Atoi(strings.TrimSpace(code))
+		if err != nil {
+			return nil, err
+		}
+		expectedCodes = append(expectedCodes, c)
+	}
+	return expectedCodes, nil
+}
+
+func containsCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
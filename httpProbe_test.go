@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTPProbe", func() {
+	var server *httptest.Server
+	var update chan StatusUpdate
+
+	BeforeEach(func() {
+		update = make(chan StatusUpdate, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/healthy":
+				w.Write([]byte(`{"status":"UP"}`))
+			case "/created":
+				w.WriteHeader(http.StatusCreated)
+			case "/slow":
+				time.Sleep(200 * time.Millisecond)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newProbe := func(data map[string]string) *HTTPProbe {
+		hp := NewHTTPProbe(&HTTPProbeConfig{
+			id:       "http",
+			update:   update,
+			interval: time.Minute,
+		})
+		err := hp.Initialize([]*Status{{
+			ID: "env",
+			Children: []*Status{{
+				ID:    "service",
+				Probe: ProbeRef{RefID: "http", Data: data},
+			}},
+		}})
+		Expect(err).To(BeNil())
+		return hp
+	}
+
+	Describe("Given a status referencing a HTTP probe", func() {
+		Context("When the url responds with the expected status code", func() {
+			It("Then the status should be good", func() {
+				newProbe(map[string]string{HTTPURLKey: server.URL + "/healthy"}).probe()
+				Expect(<-update).To(Equal(StatusUpdate{ID: "env#service", Status: StatusGood, Source: "http", Message: "200 OK"}))
+
+				newProbe(map[string]string{
+					HTTPURLKey:            server.URL + "/created",
+					HTTPExpectedStatusKey: "200, 201",
+				}).probe()
+				Expect((<-update).Status).To(Equal(StatusGood))
+			})
+		})
+		Context("When the url responds with an unexpected status code", func() {
+			It("Then the status should be bad", func() {
+				newProbe(map[string]string{HTTPURLKey: server.URL + "/broken"}).probe()
+				su := <-update
+				Expect(su.Status).To(Equal(StatusBad))
+				Expect(su.Message).To(Equal("unexpected status 500 Internal Server Error"))
+			})
+		})
+		Context("When the url takes longer than the timeout", func() {
+			It("Then the status should be bad", func() {
+				newProbe(map[string]string{
+					HTTPURLKey:     server.URL + "/slow",
+					HTTPTimeoutKey: "50ms",
+				}).probe()
+				su := <-update
+				Expect(su.Status).To(Equal(StatusBad))
+				Expect(su.Message).To(ContainSubstring("Timeout"))
+			})
+		})
+		Context("When the body is checked", func() {
+			It("Then the status should be good if it matches", func() {
+				newProbe(map[string]string{
+					HTTPURLKey:          server.URL + "/healthy",
+					HTTPBodyContainsKey: `"UP"`,
+					HTTPBodyRegexKey:    `"status":\s*"UP"`,
+				}).probe()
+				Expect((<-update).Status).To(Equal(StatusGood))
+			})
+			It("Then the status should be degraded if it does not match", func() {
+				newProbe(map[string]string{
+					HTTPURLKey:          server.URL + "/healthy",
+					HTTPBodyContainsKey: "DOWN",
+				}).probe()
+				Expect(<-update).To(Equal(StatusUpdate{ID: "env#service", Status: StatusDegraded, Source: "http", Message: "body does not contain 'DOWN'"}))
+
+				newProbe(map[string]string{
+					HTTPURLKey:       server.URL + "/healthy",
+					HTTPBodyRegexKey: `^DOWN$`,
+				}).probe()
+				Expect((<-update).Status).To(Equal(StatusDegraded))
+			})
+		})
+		Context("When the url recovers", func() {
+			It("Then the message of the failure should be replaced", func() {
+				m := NewMonitor(&MonitorConfig{Router: mux.NewRouter(), Statuses: []*Status{{ID: "env", Children: []*Status{{ID: "service"}}}}})
+				defer m.Close()
+				newProbe(map[string]string{HTTPURLKey: server.URL + "/broken"}).probe()
+				Expect(m.UpdateStatusByID(<-update)).To(Succeed())
+				newProbe(map[string]string{HTTPURLKey: server.URL + "/healthy"}).probe()
+				Expect(m.UpdateStatusByID(<-update)).To(Succeed())
+				s, err := FindStatus("env#service", m.statuses)
+				Expect(err).To(BeNil())
+				Expect(s.Status).To(Equal(StatusGood))
+				Expect(s.Message).To(Equal("200 OK"))
+			})
+		})
+		Context("When the probe data is invalid", func() {
+			It("Then it should error on initialize", func() {
+				statuses := func(data map[string]string) []*Status {
+					return []*Status{{ID: "service", Probe: ProbeRef{RefID: "http", Data: data}}}
+				}
+				hp := NewHTTPProbe(&HTTPProbeConfig{id: "http"})
+				Expect(hp.Initialize(statuses(map[string]string{}))).ToNot(BeNil())
+				Expect(hp.Initialize(statuses(map[string]string{HTTPURLKey: "http://x", HTTPExpectedStatusKey: "ok"}))).ToNot(BeNil())
+				Expect(hp.Initialize(statuses(map[string]string{HTTPURLKey: "http://x", HTTPBodyRegexKey: "("}))).ToNot(BeNil())
+				Expect(hp.Initialize(statuses(map[string]string{HTTPURLKey: "http://x", HTTPTimeoutKey: "soon"}))).ToNot(BeNil())
+			})
+		})
+	})
+})
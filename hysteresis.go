@@ -0,0 +1,84 @@
+package main
+
+import (
+	"time"
+)
+
+// Hysteresis holds back a change of status until the new status is seen often or long enough so a status
+// alternating between results does not strobe on the dashboard. A status changing too often is marked as flapping
+type Hysteresis struct {
+	Count       int    `json:"count,omitempty"`       // consecutive results of a new status after which the status changes. 0 only waits for For
+	For         string `json:"for,omitempty"`         // how long like 5m a new status is seen after which the status changes. Whichever of Count and For is met first changes it
+	FlapChanges int    `json:"flapChanges,omitempty"` // the status is flapping if the results change more than this many times within flapWindow. 0 disables
+	FlapWindow  string `json:"flapWindow,omitempty"`  // like 30m
+}
+
+// hysteresisState is what a status with a hysteresis has seen of its results
+type hysteresisState struct {
+	last    StatusValue // status of the last result
+	pending StatusValue // a new status held back
+	count   int         // consecutive results of the pending status
+	since   time.Time   // when the pending status was first seen
+	changes []time.Time // when the results changed within the flap window
+}
+
+// forDuration returns how long a new status must be seen. Invalid durations are rejected when the config is validated
+func (h *Hysteresis) forDuration() time.Duration {
+	duration, _ := time.ParseDuration(h.For)
+	return duration
+}
+
+func (h *Hysteresis) flapWindow() time.Duration {
+	window, _ := time.ParseDuration(h.FlapWindow)
+	return window
+}
+
+// hold returns whether the new status of a result should be held back because it has been seen neither often nor long enough yet.
+// The first status, the status after going stale and results keeping the current status are never held. The duration is only checked when a result arrives
+func (s *Status) hold(status StatusValue, now time.Time) bool {
+	h := s.Hysteresis
+	if h == nil || s.Status == StatusNone || s.Stale || status == s.Status {
+		s.seen.pending = StatusNone
+		return false
+	}
+	if status != s.seen.pending {
+		s.seen.pending = status
+		s.seen.count = 0
+		s.seen.since = now
+	}
+	s.seen.count++
+	countMet := h.Count > 0 && s.seen.count >= h.Count
+	forMet := h.forDuration() > 0 && now.Sub(s.seen.since) >= h.forDuration()
+	if (h.Count > 0 || h.forDuration() > 0) && !countMet && !forMet {
+		return true
+	}
+	s.seen.pending = StatusNone
+	return false
+}
+
+// trackFlapping counts the changes of the results, including those held back, and returns whether the status started
+// or stopped flapping. A status stops flapping once the changes within the window drop back to flapChanges
+func (s *Status) trackFlapping(status StatusValue, now time.Time) bool {
+	h := s.Hysteresis
+	if h == nil || h.FlapChanges <= 0 {
+		return false
+	}
+	if s.seen.last != StatusNone && s.seen.last != status {
+		s.seen.changes = append(s.seen.changes, now)
+	}
+	s.seen.last = status
+	window := h.flapWindow()
+	recent := s.seen.changes[:0]
+	for _, changed := range s.seen.changes {
+		if now.Sub(changed) < window {
+			recent = append(recent, changed)
+		}
+	}
+	s.seen.changes = recent
+	flapping := len(s.seen.changes) > h.FlapChanges
+	if flapping == s.Flapping {
+		return false
+	}
+	s.Flapping = flapping
+	return true
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hysteresis", func() {
+	var service *Status
+	var m *Monitor
+	var start time.Time
+
+	newMonitor := func(h *Hysteresis) {
+		service = &Status{ID: "service", Status: StatusGood, Hysteresis: h}
+		m = NewMonitor(&MonitorConfig{
+			Router:   mux.NewRouter(),
+			Statuses: []*Status{{ID: "prod", Rollup: &Rollup{Mode: RollupWorst}, Children: []*Status{service}}},
+		})
+		start = time.Now()
+	}
+
+	// result applies a result of the probe the given time after start
+	result := func(status StatusValue, after time.Duration) {
+		timestamp := start.Add(after)
+		Expect(m.UpdateStatusByID(StatusUpdate{ID: "prod#service", Status: status, Timestamp: &timestamp})).To(Succeed())
+	}
+
+	Describe("Given a status needing consecutive results", func() {
+		BeforeEach(func() {
+			newMonitor(&Hysteresis{Count: 3})
+		})
+
+		Context("When the results alternate", func() {
+			It("Then the status should not change", func() {
+				result(StatusBad, time.Second)
+				result(StatusBad, 2*time.Second)
+				result(StatusGood, 3*time.Second)
+				result(StatusBad, 4*time.Second)
+				Expect(service.Status).To(Equal(StatusGood))
+				Expect(m.statuses[0].Status).To(Equal(StatusGood))
+			})
+		})
+		Context("When a new status is seen enough times in a row", func() {
+			It("Then the status and its parent should change", func() {
+				result(StatusBad, time.Second)
+				result(StatusBad, 2*time.Second)
+				Expect(service.Status).To(Equal(StatusGood))
+				result(StatusBad, 3*time.Second)
+				Expect(service.Status).To(Equal(StatusBad))
+				Expect(m.statuses[0].Status).To(Equal(StatusBad))
+			})
+		})
+	})
+
+	Describe("Given a status needing a new status for a duration", func() {
+		Context("When the new status is seen for long enough", func() {
+			It("Then the status should change", func() {
+				newMonitor(&Hysteresis{For: "5m"})
+				result(StatusDegraded, time.Minute)
+				result(StatusDegraded, 4*time.Minute)
+				Expect(service.Status).To(Equal(StatusGood))
+				result(StatusDegraded, 6*time.Minute)
+				Expect(service.Status).To(Equal(StatusDegraded))
+			})
+		})
+	})
+
+	Describe("Given a status needing consecutive results or a duration", func() {
+		BeforeEach(func() {
+			newMonitor(&Hysteresis{Count: 3, For: "5m"})
+		})
+
+		Context("When the new status is seen enough times before the duration", func() {
+			It("Then the status should change", func() {
+				result(StatusBad, time.Minute)
+				result(StatusBad, 2*time.Minute)
+				Expect(service.Status).To(Equal(StatusGood))
+				result(StatusBad, 3*time.Minute)
+				Expect(service.Status).To(Equal(StatusBad))
+			})
+		})
+		Context("When the new status is seen for the duration but not enough times", func() {
+			It("Then the status should change", func() {
+				result(StatusBad, time.Minute)
+				result(StatusBad, 4*time.Minute)
+				Expect(service.Status).To(Equal(StatusGood))
+				result(StatusBad, 7*time.Minute)
+				Expect(service.Status).To(Equal(StatusBad))
+			})
+		})
+	})
+
+	Describe("Given a status with flap detection", func() {
+		BeforeEach(func() {
+			newMonitor(&Hysteresis{Count: 2, FlapChanges: 2, FlapWindow: "10m"})
+		})
+
+		Context("When the results change more often than allowed", func() {
+			It("Then it should be flapping until the changes leave the window", func() {
+				result(StatusGood, 0)
+				result(StatusBad, time.Minute)
+				result(StatusGood, 2*time.Minute)
+				Expect(service.Flapping).To(BeFalse())
+				result(StatusBad, 3*time.Minute)
+				Expect(service.Flapping).To(BeTrue())
+				Expect(service.Status).To(Equal(StatusGood))
+
+				result(StatusBad, 10*time.Minute)
+				Expect(service.Flapping).To(BeTrue())
+				Expect(service.Status).To(Equal(StatusBad))
+				result(StatusBad, 11*time.Minute)
+				Expect(service.Flapping).To(BeFalse())
+			})
+		})
+		Context("When the config is reloaded", func() {
+			It("Then the status should still be flapping", func() {
+				result(StatusGood, 0)
+				result(StatusBad, time.Minute)
+				result(StatusGood, 2*time.Minute)
+				result(StatusBad, 3*time.Minute)
+				reloaded := &Status{ID: "service", Hysteresis: &Hysteresis{FlapChanges: 2, FlapWindow: "10m"}}
+				Expect(m.ReplaceStatuses([]*Status{{ID: "prod", Children: []*Status{reloaded}}}, nil)).To(Succeed())
+				Expect(reloaded.Flapping).To(BeTrue())
+				result(StatusGood, 4*time.Minute)
+				Expect(reloaded.Flapping).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("Given a config with an invalid hysteresis", func() {
+		Context("When it is validated", func() {
+			It("Then every problem should have its path", func() {
+				err := validateConfiguration(Configuration{
+					Statuses: []*Status{
+						{ID: "web", Hysteresis: &Hysteresis{Count: -1, For: "soon", FlapChanges: 3}},
+						{ID: "api", Hysteresis: &Hysteresis{FlapChanges: -1, FlapWindow: "0s"}},
+					},
+				})
+				Expect(err).To(BeAssignableToTypeOf(ConfigError{}))
+				Expect(err.(ConfigError).Problems).To(Equal([]ConfigProblem{
+					{"statuses[0].hysteresis.count", "must not be negative"},
+					{"statuses[0].hysteresis.for", "invalid duration 'soon'"},
+					{"statuses[0].hysteresis.flapWindow", "required by flapChanges"},
+					{"statuses[1].hysteresis.flapChanges", "must not be negative"},
+					{"statuses[1].hysteresis.flapWindow", "invalid duration '0s'"},
+				}))
+			})
+		})
+	})
+})
@@ -1,12 +1,11 @@
 package main
 
 import (
-	"encoding/json"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"time"
 	"os"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/kelseyhightower/envconfig"
@@ -21,35 +20,57 @@ type EnvVar struct {
 	ConfigFileLocation string `envconfig:"CONFIG_FILE" default:"config.json"`
 	Username           string `envconfig:"USERNAME" default:"admin"`
 	Password           string `envconfig:"PASSWORD"`
+	HistoryFile        string `envconfig:"HISTORY_FILE"`
+	HistorySize        int    `envconfig:"HISTORY_SIZE" default:"1000"`
+	ExecMaxConcurrent  int    `envconfig:"EXEC_MAX_CONCURRENT" default:"8"`
 }
 
-type Configuration struct {
-	Name      string     `json:"dashboardName"`
-	Statuses  []*Status  `json:"statuses"`
-	ProbeDefs []ProbeDef `json:"probes"`
-} 
-
 func main() {
+	logging.SetBackend(redactingBackend{logging.NewLogBackend(os.Stderr, "", log.LstdFlags)})
+	if len(os.Args) > 1 && os.Args[1] == validateCommand {
+		os.Exit(runValidate(os.Args[2:], os.Stdout))
+	}
+
 	ev := getEnv()
+	err := setExecMaxConcurrent(ev.ExecMaxConcurrent)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 	r := mux.NewRouter()
 
 	c := loadConfigurationFromFile(ev.ConfigFileLocation)
+	history := createHistory(ev)
+	defer history.Close()
 	mc := &MonitorConfig{
-		Router:   r,
-		Statuses: c.Statuses,
-		Username: ev.Username,
-		Password: ev.Password,
-		Name:     c.Name,
+		Router:    r,
+		Statuses:  c.Statuses,
+		Username:  ev.Username,
+		Password:  ev.Password,
+		Name:      c.Name,
+		ProbeDefs: c.ProbeDefs,
+		History:   history,
 	}
 
 	m := NewMonitor(mc)
+	defer m.Close()
+	err = m.SetNotifiers(c.Notifiers)
+	if err != nil {
+		log.Fatal("Could not create notifier. " + err.Error())
+	}
 
-	p, err := CreateProbes(c.ProbeDefs, c.Statuses, m.GetUpdateChan())
+	p, err := CreateProbes(c.ProbeDefs, c.Statuses, m.GetUpdateChan(), m.GetHealthChan())
 	if err != nil {
 		log.Fatal("Could not create Probe. " + err.Error())
 	}
 	StartProbes(p)
-	defer StopProbes(p)
+
+	reloader := NewReloader(ev.ConfigFileLocation, c, m, p)
+	defer reloader.Close()
+	reloader.ReloadOnSignal(syscall.SIGHUP)
+	err = reloader.Watch()
+	if err != nil {
+		logger.Error("Could not watch config file, it will only be reloaded on SIGHUP or through the api", "error", err)
+	}
 
 	log.Println("Starting servic monitor on port: " + ev.Port)
 	srv := &http.Server{
@@ -70,16 +91,26 @@ func getEnv() EnvVar {
 	return ev
 }
 
-func loadConfigurationFromFile(fileLocation string) Configuration {
-	file, err := ioutil.ReadFile(fileLocation)
+// createHistory keeps history in a bolt file if HISTORY_FILE is set otherwise in memory
+func createHistory(ev EnvVar) HistoryStore {
+	if ev.HistoryFile == "" {
+		return NewMemoryHistory(ev.HistorySize)
+	}
+	history, err := NewBoltHistory(ev.HistoryFile)
 	if err != nil {
-		log.Fatal("Error reading status structure file. Error: " + err.Error())
+		log.Fatal("Error opening history file. Error: " + err.Error())
 	}
+	return history
+}
 
-	var config Configuration
-	err = json.Unmarshal(file, &config)
+func loadConfigurationFromFile(fileLocation string) Configuration {
+	config, err := readConfiguration(fileLocation)
 	if err != nil {
-		log.Fatal("Error parsing json from config file. Error: " + err.Error())
+		log.Fatal(err.Error())
+	}
+	err = validateConfiguration(config)
+	if err != nil {
+		log.Fatal(err.Error())
 	}
 	return config
 }
@@ -88,5 +119,5 @@ func StartLogger() {
 	backend := logging.NewLogBackend(os.Stderr, "", 0)
 	format := logging.MustStringFormatter(`%{color}%{shortfunc} ▶ %{level:.4s} %{color:reset} %{message}`)
 	backendFormatter := logging.NewBackendFormatter(backend, format)
-	logging.SetBackend(backendFormatter)
-}
\ No newline at end of file
+	logging.SetBackend(redactingBackend{backendFormatter})
+}
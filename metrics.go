@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "monitor_dashboard"
+	noStatusLabel    = "none" // label of statuses which have not been set yet
+	unknownSource    = "unknown"
+)
+
+var (
+	statusUpdatesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "status_updates_total",
+		Help:      "Status updates processed by source. The source is the probe id or api.",
+	}, []string{"source"})
+	probePollDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "probe_poll_duration_seconds",
+		Help:      "Time taken by each poll of a probe.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"probe"})
+	probePollErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "probe_poll_errors_total",
+		Help:      "Polls of a probe which failed.",
+	}, []string{"probe"})
+	newRelicResponsesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "newrelic_responses_total",
+		Help:      "Responses from the New Relic api by status code.",
+	}, []string{"code"})
+
+	websocketClientsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "websocket_clients"),
+		"Dashboards connected for live updates.",
+		nil, nil,
+	)
+	statusesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "statuses"),
+		"Statuses currently in each state.",
+		[]string{"status"}, nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(statusUpdatesTotal, probePollDuration, probePollErrorsTotal, newRelicResponsesTotal)
+}
+
+// observeProbePoll records the latency and result of a poll
+func observeProbePoll(probeID string, start time.Time, err error) {
+	probePollDuration.WithLabelValues(probeID).Observe(time.Since(start).Seconds())
+	if err != nil {
+		probePollErrorsTotal.WithLabelValues(probeID).Inc()
+	}
+}
+
+// observeStatusUpdate counts an update processed by the monitor
+func observeStatusUpdate(su StatusUpdate) {
+	source := su.Source
+	if source == "" {
+		source = unknownSource
+	}
+	statusUpdatesTotal.WithLabelValues(source).Inc()
+}
+
+// monitorCollector reads the current state of a monitor when metrics are scraped
+type monitorCollector struct {
+	monitor *Monitor
+}
+
+func (mc monitorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- websocketClientsDesc
+	ch <- statusesDesc
+}
+
+func (mc monitorCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(websocketClientsDesc, prometheus.GaugeValue, float64(mc.monitor.display.ClientCount()))
+
+	counts := map[StatusValue]int{}
+	for sv := range statusSeverity {
+		counts[sv] = 0
+	}
+	mc.monitor.lock.RLock()
+	forEachStatus(mc.monitor.statuses, "", func(fullStatusID string, s *Status) error {
+		counts[s.Status]++
+		return nil
+	})
+	mc.monitor.lock.RUnlock()
+	for sv, count := range counts {
+		label := string(sv)
+		if sv == StatusNone {
+			label = noStatusLabel
+		}
+		ch <- prometheus.MustNewConstMetric(statusesDesc, prometheus.GaugeValue, float64(count), label)
+	}
+}
+
+// metricsHandler serves the metrics of the monitor along with the process and probe metrics in prometheus format
+func (m *Monitor) metricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(monitorCollector{monitor: m})
+	return promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, registry}, promhttp.HandlerOpts{})
+}
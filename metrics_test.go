@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	var router *mux.Router
+
+	BeforeEach(func() {
+		router = mux.NewRouter()
+		NewMonitor(&MonitorConfig{
+			Router:   router,
+			Username: "admin",
+			Password: "password",
+			Statuses: []*Status{
+				{ID: "service1", Status: StatusGood},
+				{ID: "service2", Status: StatusGood},
+				{ID: "service3"},
+			},
+		})
+	})
+
+	getMetrics := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		r.SetBasicAuth("admin", "password")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	Describe("Given a running monitor", func() {
+		Context("When the metrics are requested without credentials", func() {
+			It("Then it should be unauthorized", func() {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+				Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+
+		Context("When the metrics are requested after an update", func() {
+			It("Then the statuses in each state and the updates should be counted", func() {
+				r := httptest.NewRequest(http.MethodPost, "/api/v1/updates", bytes.NewBufferString(`[{"id": "service2", "status": "bad"}]`))
+				r.SetBasicAuth("admin", "password")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+				Expect(w.Code).To(Equal(http.StatusOK))
+
+				w = getMetrics()
+				Expect(w.Code).To(Equal(http.StatusOK))
+				body := w.Body.String()
+				Expect(body).To(ContainSubstring(`monitor_dashboard_statuses{status="good"} 1`))
+				Expect(body).To(ContainSubstring(`monitor_dashboard_statuses{status="bad"} 1`))
+				Expect(body).To(ContainSubstring(`monitor_dashboard_statuses{status="none"} 1`))
+				Expect(body).To(ContainSubstring(`monitor_dashboard_statuses{status="degraded"} 0`))
+				Expect(body).To(ContainSubstring(`monitor_dashboard_status_updates_total{source="api"}`))
+				Expect(body).To(ContainSubstring("monitor_dashboard_websocket_clients 0"))
+				Expect(body).To(ContainSubstring("go_goroutines"))
+			})
+		})
+	})
+
+	Describe("Given a New Relic probe", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		Context("When New Relic rejects a poll", func() {
+			It("Then the response code, poll latency and error should be counted", func() {
+				// the counters are shared by every monitor so only the change is checked
+				responses := testutil.ToFloat64(newRelicResponsesTotal.WithLabelValues("403"))
+				errors := testutil.ToFloat64(probePollErrorsTotal.WithLabelValues("metrics-newrelic"))
+				nr := &NewRelicProbe{refID: "metrics-newrelic", requestURI: server.URL}
+				nr.probe()
+
+				Expect(testutil.ToFloat64(newRelicResponsesTotal.WithLabelValues("403"))).To(Equal(responses + 1))
+				Expect(testutil.ToFloat64(probePollErrorsTotal.WithLabelValues("metrics-newrelic"))).To(Equal(errors + 1))
+				body := getMetrics().Body.String()
+				Expect(body).To(ContainSubstring(`monitor_dashboard_newrelic_responses_total{code="403"}`))
+				Expect(body).To(ContainSubstring(`monitor_dashboard_probe_poll_errors_total{probe="metrics-newrelic"}`))
+				Expect(body).To(ContainSubstring(`monitor_dashboard_probe_poll_duration_seconds_count{probe="metrics-newrelic"}`))
+			})
+		})
+	})
+})
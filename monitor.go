@@ -5,6 +5,8 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -15,51 +17,116 @@ const (
 
 var (
 	StatusNotFound = errors.New("Status not found")
+	StaleUpdate    = errors.New("Update is older than the current status")
 )
 
-// Monitor is in charge of managing all the status
+// Monitor is in charge of managing all the status.
+// The status tree is guarded by lock. When both are needed, lock is always taken before the Display's lock
+// so updates reach the clients in the same order they are applied
 type Monitor struct {
+	lock     sync.RWMutex
 	statuses []*Status
 	display  *Display
 	username string
 	password string
 	update   chan StatusUpdate
+	health   chan ProbeReport
+	history  HistoryStore
+	reloader *Reloader // set if the config can be reloaded
+
+	probeIntervals map[string]time.Duration // key: probe id
+	loaded         time.Time                // when the statuses were loaded, statuses never updated are stale a ttl after
+	started        time.Time                // history of statuses which have not changed covers the time since
+
+	notifications *Notifications
+	closed        chan bool // closed to stop the background loops
+
+	probeLock   sync.Mutex
+	probeHealth map[string]*ProbeHealth // key: probe id
 }
 
 // MonitorConfig is the config to create a Monitor
 type MonitorConfig struct {
-	Router   *mux.Router
-	Statuses []*Status
-	Username string
-	Password string
-	Name     string
+	Router    *mux.Router
+	Statuses  []*Status
+	Username  string
+	Password  string
+	Name      string
+	ProbeDefs []ProbeDef
+	History   HistoryStore // defaults to keeping history in memory
 }
 
 // Statuses is the json being pass in and out of the service (to frontend).
 // It is also the structure used to define the structure of statuses to initialize the application
 type Statuses struct {
-	Statuses []*Status `json:"statuses"`
+	Statuses []*Status     `json:"statuses"`
+	Probes   []ProbeHealth `json:"probes,omitempty"`
 }
 
 // Status is the core unit to anything that has a good/degraded/bad/unknown status.
 type Status struct {
-	ID         string    `json:"id"`
-	FullName   string    `json:"fullName"`
-	AbbrevName string    `json:"abbrevName"`
-	SubText    string    `json:"subText"`
-	Status     string    `json:"status"`
-	Children   []*Status `json:"children"`
-	URL        string    `json:"url"`
-	Probe      ProbeRef  `json:"probe"`
+	ID         string      `json:"id"`
+	FullName   string      `json:"fullName"`
+	AbbrevName string      `json:"abbrevName"`
+	SubText    string      `json:"subText"`
+	Status     StatusValue `json:"status"`
+	Children   []*Status   `json:"children"`
+	URL        string      `json:"url"`
+	Message    string      `json:"message,omitempty"`
+	Probe      ProbeRef    `json:"probe"`
+	Rollup     *Rollup     `json:"rollup,omitempty"`     // computes the status from the children if set
+	ShowUptime string      `json:"showUptime,omitempty"` // shows the uptime over this duration as the sub-text if set
+	Notify     []string    `json:"notify,omitempty"`     // ids of the notifiers sent transitions of this status and its children
+	Hysteresis *Hysteresis `json:"hysteresis,omitempty"` // holds back changes of status and detects flapping if set
+	Flapping   bool        `json:"flapping,omitempty"`   // whether the results keep changing, set by the hysteresis
+	TTL        string      `json:"ttl,omitempty"`        // how long like 5m the status can go without an update before it is stale. Defaults to a few probe intervals
+	Stale      bool        `json:"stale,omitempty"`      // whether the status is unknown because it was not updated within its ttl
+
+	updated time.Time       // time of the last update applied
+	seen    hysteresisState // results seen by the hysteresis
+}
+
+// MarshalJSON hides any secret from the config in the text shown on the dashboard.
+// Statuses which have been updated also have when and how long ago
+func (s Status) MarshalJSON() ([]byte, error) {
+	type status Status // without the MarshalJSON method
+	redacted := status(s)
+	redacted.FullName = secrets.redactField(s.FullName)
+	redacted.AbbrevName = secrets.redactField(s.AbbrevName)
+	redacted.SubText = secrets.redactField(s.SubText)
+	redacted.URL = secrets.redactField(s.URL)
+	redacted.Message = secrets.redact(s.Message)
+	if s.updated.IsZero() {
+		return json.Marshal(redacted)
+	}
+	return json.Marshal(struct {
+		status
+		LastUpdated time.Time `json:"lastUpdated"`
+		Age         string    `json:"age"`
+	}{redacted, s.updated, formatAge(time.Since(s.updated))})
 }
 
 // NewMonitor returns a new Monitor
 func NewMonitor(config *MonitorConfig) *Monitor {
+	computeRollups(config.Statuses)
+	history := config.History
+	if history == nil {
+		history = NewMemoryHistory(defaultHistorySize)
+	}
 	monitor := &Monitor{
-		statuses: config.Statuses,
-		username: config.Username,
-		password: config.Password,
-		update:   make(chan StatusUpdate),
+		history:     history,
+		statuses:    config.Statuses,
+		username:    config.Username,
+		password:    config.Password,
+		update:      make(chan StatusUpdate),
+		health:      make(chan ProbeReport),
+		probeHealth: newProbeHealths(config.ProbeDefs),
+
+		probeIntervals: probeIntervals(config.ProbeDefs),
+		loaded:         time.Now(),
+		started:        time.Now(),
+		notifications:  NewNotifications(),
+		closed:         make(chan bool),
 	}
 
 	config.Router.Handle("/status", monitor.basicAuth(monitor.getStatusHandler(), true)).Methods(http.MethodGet)
@@ -67,26 +134,81 @@ func NewMonitor(config *MonitorConfig) *Monitor {
 	// This is not very REST friendly but will make updating less complicated
 	config.Router.Handle("/update/{id}/{status}", monitor.basicAuth(monitor.updateStatusHandler(), true)).Methods(http.MethodGet)
 
+	monitor.routeAPI(config.Router)
+
 	monitor.display = NewDisplay(config.Name)
+	monitor.display.SetSnapshotSource(monitor.snapshot, monitor.lock.RLocker())
 	config.Router.Handle("/live", monitor.basicAuth(monitor.display.LiveStatus(), true))
+	config.Router.Handle("/metrics", monitor.basicAuth(monitor.metricsHandler(), true)).Methods(http.MethodGet)
 	monitor.display.RouteStatic(config.Router)
 
 	go monitor.updateListener()
+	go monitor.healthListener()
+	go monitor.uptimeRefresher()
+	go monitor.staleSweeper()
 
 	return monitor
 }
 
+// Close stops refreshing the uptimes and marking statuses stale. It must only be called once
+func (m *Monitor) Close() {
+	close(m.closed)
+}
+
 func (m *Monitor) updateListener() {
 	for {
 		status := <-m.update
 		err := m.UpdateStatusByID(status)
 		if err != nil {
 			logger.Error(err.Error())
-			// throw to error chan to go to show up in frontend
+			if status.Source != "" {
+				m.reportProbe(ProbeReport{
+					ProbeID: status.Source,
+					Err:     err,
+					Time:    time.Now(),
+				})
+			}
 		}
 	}
 }
 
+func (m *Monitor) healthListener() {
+	for {
+		report := <-m.health
+		m.reportProbe(report)
+	}
+}
+
+// reportProbe records the result of a probe poll and shows any change in probe health on the dashboard
+func (m *Monitor) reportProbe(report ProbeReport) {
+	m.probeLock.Lock()
+	ph, ok := m.probeHealth[report.ProbeID]
+	if !ok {
+		ph = &ProbeHealth{ID: report.ProbeID, Healthy: true}
+		m.probeHealth[report.ProbeID] = ph
+	}
+	changed := ph.apply(report)
+	health := *ph
+	m.probeLock.Unlock()
+
+	if report.Err != nil {
+		logger.Error("Probe failed", "refID", report.ProbeID, "failures", health.ConsecutiveFailures, "error", report.Err)
+	}
+	if changed {
+		err := m.display.SendProbeHealth(health)
+		if err != nil {
+			logger.Error("Could not send probe health", "error", err)
+		}
+	}
+}
+
+// ProbeHealths returns the current health of all probes sorted by id
+func (m *Monitor) ProbeHealths() []ProbeHealth {
+	m.probeLock.Lock()
+	defer m.probeLock.Unlock()
+	return sortedProbeHealths(m.probeHealth)
+}
+
 func (m *Monitor) basicAuth(h http.Handler, prompt bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		username, password, isOk := r.BasicAuth()
@@ -110,23 +232,37 @@ func login() http.Handler {
 
 func (m *Monitor) getStatusHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ss := Statuses{
-			Statuses: m.statuses,
-		}
-		json, _ := json.Marshal(ss)
+		m.lock.RLock()
+		json, _ := json.Marshal(m.snapshot())
+		m.lock.RUnlock()
 		w.Write(json)
 		w.WriteHeader(http.StatusOK)
 	})
 }
 
+// snapshot returns the current statuses along with the health of the probes. Must be called with the lock held
+func (m *Monitor) snapshot() Statuses {
+	return Statuses{
+		Statuses: m.statuses,
+		Probes:   m.ProbeHealths(),
+	}
+}
+
 func (m *Monitor) updateStatusHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
+		status, err := ParseStatusValue(vars["status"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error() + "\n"))
+			return
+		}
 		su := StatusUpdate{
 			ID:     vars["id"],
-			Status: vars["status"],
+			Status: status,
+			Source: apiSource,
 		}
-		err := m.UpdateStatusByID(su)
+		err = m.UpdateStatusByID(su)
 		switch {
 		case err == StatusNotFound:
 			w.WriteHeader(http.StatusNotFound)
@@ -141,31 +277,204 @@ func (m *Monitor) updateStatusHandler() http.Handler {
 	})
 }
 
+// ReplaceStatuses swaps in a new status tree after the config is reloaded. Statuses with the same full id as one
+// in the current tree keep their current status so a reload does not blank the dashboard. Clients are sent the new tree
+func (m *Monitor) ReplaceStatuses(statuses []*Status, probeDefs []ProbeDef) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	previous := map[string]StatusValue{}
+	forEachStatus(statuses, "", func(fullStatusID string, s *Status) error {
+		old, err := FindStatus(fullStatusID, m.statuses)
+		if err != nil {
+			return nil
+		}
+		previous[fullStatusID] = old.Status
+		s.Status = old.Status
+		s.Message = old.Message
+		s.updated = old.updated
+		s.Stale = old.Stale
+		if s.Hysteresis != nil {
+			s.seen = old.seen
+			s.Flapping = old.Flapping && s.Hysteresis.FlapChanges > 0
+		}
+		return nil
+	})
+	computeRollups(statuses)
+	forEachStatus(statuses, "", func(fullStatusID string, s *Status) error {
+		old, ok := previous[fullStatusID]
+		if ok && s.Rollup != nil && old != s.Status {
+			m.recordTransition(fullStatusID, old, s.Status, rollupSource, time.Now())
+		}
+		return nil
+	})
+	m.statuses = statuses
+	m.probeIntervals = probeIntervals(probeDefs)
+	m.loaded = time.Now()
+
+	m.probeLock.Lock()
+	healths := newProbeHealths(probeDefs)
+	for id, ph := range healths {
+		if existing, ok := m.probeHealth[id]; ok {
+			existing.Type = ph.Type
+			healths[id] = existing
+		}
+	}
+	m.probeHealth = healths
+	m.probeLock.Unlock()
+
+	return m.display.SendStructure(m.snapshot())
+}
+
 // UpdateStatusByID updates the status where the id is concatenation of ids from parent to target status
 func (m *Monitor) UpdateStatusByID(su StatusUpdate) error {
-	s, err := FindStatus(su.ID, m.statuses)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, err := m.applyUpdate(su)
+	if err == StaleUpdate {
+		logger.Debug("Ignoring stale update", "update", su)
+		return nil
+	}
+	return err
+}
+
+// applyUpdate updates the status and sends it to the display if it changed. Whether the status changed is returned.
+// Must be called with the lock held
+func (m *Monitor) applyUpdate(su StatusUpdate) (bool, error) {
+	observeStatusUpdate(su)
+	if !su.Status.IsValid() {
+		return false, InvalidStatusError{Value: string(su.Status)}
+	}
+	path, err := findStatusPath(su.ID, m.statuses)
 	if err != nil {
 		logger.Debug("Could not find status", "id", su.ID)
-		return err
+		return false, err
+	}
+	s := path[len(path)-1]
+	if su.Timestamp != nil && su.Timestamp.Before(s.updated) {
+		return false, StaleUpdate
+	}
+	now := time.Now()
+	if su.Timestamp != nil {
+		now = *su.Timestamp
+	}
+	flapping := s.trackFlapping(su.Status, now)
+	if flapping {
+		logger.Info("Status flapping changed", "id", su.ID, "flapping", s.Flapping)
+		err = m.display.SendFlapping(su.ID, s.Flapping)
+		if err != nil {
+			return true, err
+		}
+	}
+	if s.hold(su.Status, now) {
+		logger.Debug("Holding back status change", "update", su, "results", s.seen.count)
+		s.updated = now // the probe is still reporting so the status is not stale
+		return flapping, nil
+	}
+	old := s.Status
+	if !s.apply(su) {
+		return flapping, nil
+	}
+	if old != s.Status {
+		m.recordTransition(su.ID, old, s.Status, su.Source, s.updated)
+		m.notify(path, su.ID, old, su.Source, s.updated)
+	}
+	logger.Debug("New status update!", "update", su)
+	updated := s.updated
+	su.Timestamp = &updated
+	err = m.display.Send(su)
+	if err != nil {
+		return true, err
+	}
+	return true, m.updateRollups(path[:len(path)-1], s.updated)
+}
+
+// updateRollups recomputes the parents with a roll-up from the nearest parent upwards and sends any changes to the display.
+// The parents change at the same time as the child that caused it
+func (m *Monitor) updateRollups(parents []*Status, timestamp time.Time) error {
+	ids := []string{}
+	for _, parent := range parents {
+		ids = append(ids, parent.ID)
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		parent := parents[i]
+		if parent.Rollup == nil {
+			continue
+		}
+		status := parent.Rollup.Compute(parent.Children)
+		if status == parent.Status {
+			continue
+		}
+		su := StatusUpdate{
+			ID:     strings.Join(ids[:i+1], IdDelimiter),
+			Status: status,
+		}
+		m.recordTransition(su.ID, parent.Status, status, rollupSource, timestamp)
+		old := parent.Status
+		parent.Status = status
+		m.notify(parents[:i+1], su.ID, old, rollupSource, timestamp)
+		logger.Debug("New roll-up status update!", "update", su)
+		err := m.display.Send(su)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply updates the status with the update and returns whether anything changed
+func (s *Status) apply(su StatusUpdate) bool {
+	s.updated = time.Now()
+	if su.Timestamp != nil {
+		s.updated = *su.Timestamp
+	}
+	changed := false
+	if s.Stale {
+		s.Stale = false
+		s.Message = su.Message
+		changed = true
 	}
 	if s.Status != su.Status {
 		s.Status = su.Status
-		logger.Debug("New status update!", "update", su)
-		return m.display.Send(su)
+		changed = true
 	}
-	return nil
+	if su.Message != "" && s.Message != su.Message {
+		s.Message = su.Message
+		changed = true
+	}
+	if su.SubText != "" && s.SubText != su.SubText {
+		s.SubText = su.SubText
+		changed = true
+	}
+	if su.URL != "" && s.URL != su.URL {
+		s.URL = su.URL
+		changed = true
+	}
+	return changed
 }
 
 func FindStatus(id string, statuses []*Status) (*Status, error) {
+	path, err := findStatusPath(id, statuses)
+	if err != nil {
+		return nil, err
+	}
+	return path[len(path)-1], nil
+}
+
+// findStatusPath returns every status from the top parent to the target status
+func findStatusPath(id string, statuses []*Status) ([]*Status, error) {
 	ids := strings.SplitN(id, IdDelimiter, 2)
 	currentID := ids[0]
 	for _, s := range statuses {
 		if s.ID == currentID {
 			if len(ids) >= 2 {
 				nextIDs := ids[1]
-				return FindStatus(nextIDs, s.Children)
+				path, err := findStatusPath(nextIDs, s.Children)
+				if err != nil {
+					return nil, err
+				}
+				return append([]*Status{s}, path...), nil
 			}
-			return s, nil
+			return []*Status{s}, nil
 		}
 	}
 	logger.Debug("Could not find id during traversal", "id", currentID)
@@ -175,3 +484,67 @@ func FindStatus(id string, statuses []*Status) (*Status, error) {
 func (m *Monitor) GetUpdateChan() chan StatusUpdate {
 	return m.update
 }
+
+// recordTransition adds a status change to the history. Failing to record does not stop the update
+func (m *Monitor) recordTransition(id string, old, new StatusValue, source string, timestamp time.Time) {
+	err := m.history.Record(Transition{
+		ID:        id,
+		Old:       old,
+		New:       new,
+		Source:    source,
+		Timestamp: timestamp,
+	})
+	if err != nil {
+		logger.Error("Could not record status transition", "id", id, "error", err)
+	}
+}
+
+// notify sends the transition of the last status of the path to the notifiers of the status and its parents.
+// Must be called with the lock held
+func (m *Monitor) notify(path []*Status, id string, old StatusValue, source string, timestamp time.Time) {
+	names := []string{}
+	notifierIDs := []string{}
+	for _, s := range path {
+		name := s.FullName
+		if name == "" {
+			name = s.ID
+		}
+		names = append(names, name)
+		for _, notifierID := range s.Notify {
+			if !containsString(notifierIDs, notifierID) {
+				notifierIDs = append(notifierIDs, notifierID)
+			}
+		}
+	}
+	if len(notifierIDs) == 0 {
+		return
+	}
+	s := path[len(path)-1]
+	group, groupName := id, names[0]
+	if len(path) > 1 {
+		group = id[:strings.LastIndex(id, IdDelimiter)]
+		groupName = strings.Join(names[:len(names)-1], " / ")
+	}
+	m.notifications.Notify(notifierIDs, Notification{
+		ID:        id,
+		FullName:  strings.Join(names, " / "),
+		URL:       s.URL,
+		Status:    s.Status,
+		Previous:  old,
+		Message:   s.Message,
+		Source:    source,
+		Timestamp: timestamp,
+		group:     group,
+		groupName: groupName,
+	})
+}
+
+// SetNotifiers creates the notifiers and replaces the current ones. If any cannot be created the current ones are kept
+func (m *Monitor) SetNotifiers(defs []NotifierDef) error {
+	return m.notifications.Replace(defs)
+}
+
+// GetHealthChan returns the channel probes report the result of each poll to
+func (m *Monitor) GetHealthChan() chan ProbeReport {
+	return m.health
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -14,9 +18,9 @@ var _ = Describe("ServiceMonitor", func() {
 	child4 := &Status{
 		ID: "child4",
 		Probe: ProbeRef{
-			Type: "NewRelic",
+			RefID: "NewRelic",
 			Data: map[string]string{
-				MonitorNameKey: "monitor4",
+				NewRelicMonitorNameKey: "monitor4",
 			},
 		},
 	}
@@ -24,9 +28,9 @@ var _ = Describe("ServiceMonitor", func() {
 		ID:     "child3",
 		Status: "good",
 		Probe: ProbeRef{
-			Type: "NewRelic",
+			RefID: "NewRelic",
 			Data: map[string]string{
-				MonitorNameKey: "monitor3",
+				NewRelicMonitorNameKey: "monitor3",
 			},
 		},
 	}
@@ -37,8 +41,8 @@ var _ = Describe("ServiceMonitor", func() {
 	child1 := &Status{
 		ID: "child1",
 		Probe: ProbeRef{
-			Type: "NewRelic",
-			Data: map[string]string{},
+			RefID: "NewRelic",
+			Data:  map[string]string{},
 		},
 	}
 	parent := &Status{
@@ -82,6 +86,50 @@ var _ = Describe("ServiceMonitor", func() {
 			})
 		})
 
+		Describe("Given a Monitor with probes", func() {
+			mc := &MonitorConfig{
+				Router:    mux.NewRouter(),
+				Statuses:  []*Status{},
+				ProbeDefs: []ProbeDef{{ID: "probe1", Type: HTTPType}},
+			}
+			m := NewMonitor(mc)
+			Context("When a probe reports an error", func() {
+				It("Then the probe should be unhealthy with the error", func() {
+					m.GetHealthChan() <- ProbeReport{ProbeID: "probe1", Err: errors.New("oh no"), Time: time.Now()}
+					m.GetHealthChan() <- ProbeReport{ProbeID: "probe1", Err: errors.New("oh no"), Time: time.Now()}
+					Eventually(m.ProbeHealths).Should(ConsistOf(WithTransform(func(ph ProbeHealth) int {
+						return ph.ConsecutiveFailures
+					}, Equal(2))))
+					ph := m.ProbeHealths()[0]
+					Expect(ph.Type).To(Equal(HTTPType))
+					Expect(ph.Healthy).To(BeFalse())
+					Expect(ph.LastError).To(Equal("oh no"))
+				})
+			})
+			Context("When a probe reports a success after an error", func() {
+				It("Then the probe should be healthy again", func() {
+					m.GetHealthChan() <- ProbeReport{ProbeID: "probe1", Time: time.Now()}
+					Eventually(func() bool {
+						return m.ProbeHealths()[0].Healthy
+					}).Should(BeTrue())
+					ph := m.ProbeHealths()[0]
+					Expect(ph.ConsecutiveFailures).To(Equal(0))
+					Expect(ph.LastSuccess).ToNot(BeNil())
+					Expect(ph.LastError).To(Equal("oh no"))
+				})
+			})
+			Context("When getting the statuses", func() {
+				It("Then the probes should be included", func() {
+					w := httptest.NewRecorder()
+					m.getStatusHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+					var ss Statuses
+					Expect(json.Unmarshal(w.Body.Bytes(), &ss)).To(Succeed())
+					Expect(ss.Probes).To(HaveLen(1))
+					Expect(ss.Probes[0].ID).To(Equal("probe1"))
+				})
+			})
+		})
+
 		Describe("Given a Monitor", func() {
 			mc := &MonitorConfig{
 				Router:   mux.NewRouter(),
@@ -96,7 +144,7 @@ var _ = Describe("ServiceMonitor", func() {
 						Status: "good",
 					})
 					Expect(err).To(BeNil())
-					Expect(child3.Status).To(Equal("good"))
+					Expect(child3.Status).To(Equal(StatusGood))
 				})
 			})
 			Context("When a Status does not exist", func() {
@@ -112,8 +160,65 @@ var _ = Describe("ServiceMonitor", func() {
 	})
 
 	Describe("Probe", func() {
+		Describe("Given creating probes from probe definitions", func() {
+			httpStatuses := []*Status{{
+				ID: "service",
+				Probe: ProbeRef{
+					RefID: "http",
+					Data:  map[string]string{HTTPURLKey: "http://localhost"},
+				},
+			}}
+			Context("When the probe type is registered and the data is complete", func() {
+				It("Then the probe should be created", func() {
+					probes, err := CreateProbes([]ProbeDef{{
+						ID:   "http",
+						Type: HTTPType,
+						Data: map[string]string{ProbeIntervalKey: "1m"},
+					}}, httpStatuses, make(chan StatusUpdate), nil)
+					Expect(err).To(BeNil())
+					Expect(probes).To(HaveLen(1))
+					Expect(probes[0].(*HTTPProbe).interval).To(Equal(time.Minute))
+				})
+			})
+			Context("When the probe type is unknown", func() {
+				It("Then it should error with the supported types", func() {
+					_, err := CreateProbes([]ProbeDef{{ID: "mystery", Type: "Mystery"}}, httpStatuses, make(chan StatusUpdate), nil)
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring("HTTP, NewRelic"))
+				})
+			})
+			Context("When the probe definition is missing data", func() {
+				It("Then it should error", func() {
+					_, err := CreateProbes([]ProbeDef{{ID: "http", Type: HTTPType, Data: map[string]string{}}}, httpStatuses, make(chan StatusUpdate), nil)
+					Expect(err).ToNot(BeNil())
+
+					_, err = CreateProbes([]ProbeDef{{
+						ID:   "http",
+						Type: HTTPType,
+						Data: map[string]string{ProbeIntervalKey: "often"},
+					}}, httpStatuses, make(chan StatusUpdate), nil)
+					Expect(err).ToNot(BeNil())
+				})
+			})
+			Context("When a status referencing the probe is missing data", func() {
+				It("Then it should error with the status id", func() {
+					_, err := CreateProbes([]ProbeDef{{
+						ID:   "NewRelic",
+						Type: NewRelicType,
+						Data: map[string]string{
+							NewRelicIntervalKey:      "1m",
+							NewRelicAPIEnvKey:        "KEY",
+							NewRelicAccountNumberKey: "1",
+						},
+					}}, statuses, make(chan StatusUpdate), nil)
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring("parent#child1"))
+				})
+			})
+		})
+
 		Describe("Given creating status cache for New Relic Probe", func() {
-			config := &NewRelicProbeConfig{}
+			config := &NewRelicProbeConfig{id: "NewRelic"}
 			nr := NewNewRelicProbe(config)
 			Context("When the probe type and monitor name exist", func() {
 				It("Then it should be added to the cache correctly", func() {
@@ -158,6 +263,89 @@ var _ = Describe("ServiceMonitor", func() {
 			})
 		})
 
+		Describe("Given New Relic responds with an error", func() {
+			Context("When the probe polls", func() {
+				It("Then the error should be reported to the health channel", func() {
+					server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.WriteHeader(http.StatusForbidden)
+						w.Write([]byte(`{"error":"bad key"}`))
+					}))
+					defer server.Close()
+					health := make(chan ProbeReport, 1)
+					nr := NewNewRelicProbe(&NewRelicProbeConfig{id: "NewRelic", health: health})
+					nr.requestURI = server.URL
+
+					nr.probe()
+					report := <-health
+					Expect(report.ProbeID).To(Equal("NewRelic"))
+					Expect(report.Err).To(MatchError(fmt.Sprintf(BadNewRelicStatusCode, http.StatusForbidden)))
+				})
+			})
+		})
+
+		Describe("Given New Relic stops returning the result of a monitor", func() {
+			var responses []string
+			var server *httptest.Server
+			var update chan StatusUpdate
+			var nr *NewRelicProbe
+
+			// result is a response with a result of monitor3 the given time ago
+			result := func(ago time.Duration) string {
+				millis := time.Now().Add(-ago).UnixNano() / int64(time.Millisecond)
+				return fmt.Sprintf(`{"results": [{"events": [{"timestamp": %d, "monitorName": "monitor3", "result": "FAILED"}]}]}`, millis)
+			}
+
+			BeforeEach(func() {
+				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(responses[0]))
+					responses = responses[1:]
+				}))
+				update = make(chan StatusUpdate, 2)
+				nr = NewNewRelicProbe(&NewRelicProbeConfig{id: "NewRelic", update: update, health: make(chan ProbeReport, 2), interval: time.Minute})
+				Expect(nr.Initialize([]*Status{child2})).To(Succeed())
+				nr.requestURI = server.URL
+			})
+
+			AfterEach(func() {
+				server.Close()
+			})
+
+			Context("When the last result is within the ttl", func() {
+				It("Then the last result should be sent again", func() {
+					responses = []string{result(time.Minute), `{"results": [{"events": []}]}`}
+					for i := 0; i < 2; i++ {
+						nr.probe()
+						var su StatusUpdate
+						Eventually(update).Should(Receive(&su))
+						Expect(su.ID).To(Equal(child2.ID + IdDelimiter + child3.ID))
+						Expect(su.Status).To(Equal(StatusBad))
+					}
+					// monitor4 never had a result so is left alone
+					Consistently(update).ShouldNot(Receive())
+				})
+			})
+			Context("When the last result is older than the ttl", func() {
+				It("Then it should not be sent again and the status should go stale", func() {
+					s := &Status{ID: "child3", TTL: "3m", Probe: child3.Probe}
+					m := NewMonitor(&MonitorConfig{Router: mux.NewRouter(), Statuses: []*Status{{ID: "child2", Children: []*Status{s}}}})
+					defer m.Close()
+					responses = []string{result(5 * time.Minute), `{"results": [{"events": []}]}`}
+
+					nr.probe()
+					var su StatusUpdate
+					Eventually(update).Should(Receive(&su))
+					Expect(m.UpdateStatusByID(su)).To(Succeed())
+					Expect(s.Status).To(Equal(StatusBad))
+
+					nr.probe()
+					Consistently(update).ShouldNot(Receive())
+					m.sweepStale(time.Now().Add(4 * time.Minute))
+					Expect(s.Status).To(Equal(StatusUnknown))
+					Expect(s.Stale).To(BeTrue())
+				})
+			})
+		})
+
 		Describe("Given creating New Relic query", func() {
 			monitorNames := []string{"name1", "name2"}
 			Context("When cache is empty", func() {
@@ -221,7 +409,7 @@ var _ = Describe("ServiceMonitor", func() {
 						cache[name] = &StatusUpdate{}
 					}
 					interval, _ := time.ParseDuration("5m")
-					query := createRequestURL(cache, interval)
+					query := createRequestURL(cache, "918250", interval)
 					expected := "https://insights-api.newrelic.com/v1/accounts/918250/query?nrql=SELECT%20monitorName%2C%20result%20FROM%20SyntheticCheck%20WHERE%20monitorName%20IN%20%28%27name1%27%2C%27name2%27%29%20SINCE%208%20minutes%20ago%20LIMIT%20100"
 					Expect(query).To(Equal(expected))
 				})
@@ -7,6 +7,9 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -24,12 +27,14 @@ const (
 
 	MissingMonitorNameKey   = "%s is missing 'MonitorName' field in 'data' for New Relic probe"
 	MissingProbeConfigValue = "Missing probe configuration value. Requires: accountNumber, interval, apiKeyEnvVar in data map"
+	BadNewRelicStatusCode   = "Bad status code from New Relic: %d"
 )
 
 // NewRelicProbeConfig is the configuration for a new relic probe
 type NewRelicProbeConfig struct {
 	id       string
 	update   chan StatusUpdate
+	health   chan ProbeReport
 	interval time.Duration
 	key      string
 	account  string
@@ -40,12 +45,14 @@ type NewRelicProbe struct {
 	refID      string
 	account    string
 	update     chan StatusUpdate
+	health     chan ProbeReport
 	interval   time.Duration
 	ticker     *time.Ticker
 	stopChan   chan bool
 	key        string
 	requestURI string
 	statuses   map[string]*StatusUpdate // key: new relic monitor name
+	ttls       map[string]time.Duration // key: new relic monitor name. How long the last result is sent again, 0 forever
 }
 
 // NewRelicResponse
@@ -59,16 +66,44 @@ type NewRelicResponse struct {
 	} `json:"results"`
 }
 
+func init() {
+	RegisterProbeFactory(ProbeFactory{
+		Type:            NewRelicType,
+		RequiredDefKeys: []string{NewRelicIntervalKey, NewRelicAPIEnvKey, NewRelicAccountNumberKey},
+		RequiredRefKeys: []string{NewRelicMonitorNameKey},
+		New:             newNewRelicProbeFromConfig,
+	})
+}
+
+// newNewRelicProbeFromConfig creates and initializes a new relic probe for the probe registry
+func newNewRelicProbeFromConfig(config ProbeConfig, statuses []*Status) (Probe, error) {
+	nrp := NewNewRelicProbe(&NewRelicProbeConfig{
+		id:       config.ID,
+		update:   config.Update,
+		health:   config.Health,
+		interval: config.Interval,
+		key:      os.Getenv(config.Data[NewRelicAPIEnvKey]),
+		account:  config.Data[NewRelicAccountNumberKey],
+	})
+	err := nrp.Initialize(statuses)
+	if err != nil {
+		return nil, err
+	}
+	return nrp, nil
+}
+
 // NewNewRelicProbe returns a new relic probe
 func NewNewRelicProbe(config *NewRelicProbeConfig) *NewRelicProbe {
 	return &NewRelicProbe{
 		refID:    config.id,
 		account:  config.account,
 		update:   config.update,
+		health:   config.health,
 		interval: config.interval,
 		stopChan: make(chan bool),
 		key:      config.key,
 		statuses: make(map[string]*StatusUpdate),
+		ttls:     make(map[string]time.Duration),
 	}
 }
 
@@ -93,6 +128,8 @@ func (nr *NewRelicProbe) Start() {
 			case <-nr.ticker.C:
 				nr.probe()
 			case <-nr.stopChan:
+				nr.ticker.Stop()
+				nr.ticker = nil
 				logger.Debug("Exiting New Relic Probe", "refID", nr.refID)
 				return
 			}
@@ -103,21 +140,19 @@ func (nr *NewRelicProbe) Start() {
 // Stops sending requests to new relic for updates
 func (nr *NewRelicProbe) Stop() {
 	nr.stopChan <- true
-	nr.ticker.Stop()
-	nr.ticker = nil
-	return
 }
 
 func (nr *NewRelicProbe) probe() {
+	start := time.Now()
 	nrn, err := nr.requestNewRelic()
+	reportProbeHealth(nr.health, nr.refID, start, err)
 	if err != nil {
-		logger.Error(err.Error())
-		// should return to error chan so it shows up on the frontend
-		// go nr.Stop() ... need to do that ^^^^^
 		return
 	}
 	updatedMonitors := nr.updateCache(nrn)
-	nr.sendUpdatesForMonitors(updatedMonitors)
+	// results still within the ttl are sent again as the query only returns results within its window and monitors
+	// running less often would otherwise go stale between their runs. Deleted or stopped monitors still go stale
+	nr.sendUpdatesForMonitors(nr.reportedMonitors(updatedMonitors, time.Now()))
 }
 
 // createCache creates the map in which future new relic requests will be based off of
@@ -142,6 +177,11 @@ func (nr *NewRelicProbe) createCache(id string, statuses []*Status, statusID str
 				Status:           s.Status,
 				lastUpdateMillis: 0,
 			}
+			ttl, err := statusTTL(s, nr.interval)
+			if err != nil {
+				return fmt.Errorf("%s has %s", s.FullName, err.Error())
+			}
+			nr.ttls[monitorName] = ttl
 		}
 
 		if len(s.Children) > 0 {
@@ -181,16 +221,45 @@ func (nr *NewRelicProbe) updateCache(nrn NewRelicResponse) []string {
 	return updatedMonitors
 }
 
+// reportedMonitors returns the names of the updated monitors along with those whose last result is still within
+// the ttl of their status by now
+func (nr *NewRelicProbe) reportedMonitors(updatedMonitors []string, now time.Time) []string {
+	reported := map[string]bool{}
+	for _, monitorName := range updatedMonitors {
+		reported[monitorName] = true
+	}
+	nowMillis := int(now.UnixNano() / int64(time.Millisecond))
+	for monitorName, s := range nr.statuses {
+		if s.lastUpdateMillis == 0 {
+			continue
+		}
+		ttl := nr.ttls[monitorName]
+		if ttl == 0 || time.Duration(nowMillis-s.lastUpdateMillis)*time.Millisecond < ttl {
+			reported[monitorName] = true
+		}
+	}
+	monitorNames := []string{}
+	for monitorName := range reported {
+		monitorNames = append(monitorNames, monitorName)
+	}
+	sort.Strings(monitorNames)
+	return monitorNames
+}
+
 // sendUpdatesForMonitors passes StatusUpdate to channel for a list of monitor names
 func (nr *NewRelicProbe) sendUpdatesForMonitors(monitorNames []string) {
 	logger.Debug("Got New Relic monitor statuses", "refID", nr.refID, "count", len(monitorNames))
 	for _, name := range monitorNames {
-		go func(monitorName string) {
-			update, ok := nr.statuses[monitorName]
-			if ok {
-				nr.update <- *update
-			}
-		}(name)
+		update, ok := nr.statuses[name]
+		if !ok {
+			continue
+		}
+		// copy so the cache can be updated by the next probe while this is waiting to be sent
+		su := *update
+		su.Source = nr.refID
+		go func(su StatusUpdate) {
+			nr.update <- su
+		}(su)
 	}
 }
 
@@ -208,19 +277,21 @@ func (nr *NewRelicProbe) requestNewRelic() (NewRelicResponse, error) {
 	if err != nil {
 		return NewRelicResponse{}, err
 	}
+	defer resp.Body.Close()
+	newRelicResponsesTotal.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
 	var b bytes.Buffer
 	b.ReadFrom(resp.Body)
 
+	if resp.StatusCode != http.StatusOK {
+		return NewRelicResponse{}, fmt.Errorf(BadNewRelicStatusCode, resp.StatusCode)
+	}
+
 	var nrn NewRelicResponse
 	err = json.Unmarshal(b.Bytes(), &nrn)
 	if err != nil {
 		return NewRelicResponse{}, err
 	}
 
-	if resp.StatusCode > 200 {
-		logger.Error("Bad status code form New Relic", "refID", nr.refID, "status code", resp.StatusCode)
-	}
-
 	return nrn, nil
 }
 
@@ -248,5 +319,6 @@ func monitorNamesFromCache(cache map[string]*StatusUpdate) []string {
 	for monitorName := range cache {
 		monitorNames = append(monitorNames, monitorName)
 	}
+	sort.Strings(monitorNames)
 	return monitorNames
 }
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	notifierQueueSize = 100 // notifications waiting to be sent by each notifier before new ones are dropped
+	notifierTimeout   = 10 * time.Second
+	transitionArrow   = "->"
+	anyStatus         = "*"
+)
+
+var (
+	defaultNotifierTransitions = []string{"*->bad", "bad->good"}
+	defaultNotifierTemplate    = `{{.FullName}} is {{.Status}} (was {{.Previous}}){{if .Message}}: {{.Message}}{{end}}{{if .URL}} {{.URL}}{{end}}`
+)
+
+// Notifier sends notifications of status transitions somewhere people will notice them
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// NotifierDef defines a notifier like a Slack webhook. Statuses are routed to it with their notify field
+type NotifierDef struct {
+	ID          string            `json:"id"`
+	Type        string            `json:"type"`
+	Transitions []string          `json:"transitions,omitempty"` // like good->bad or *->good. Defaults to *->bad and bad->good
+	Template    string            `json:"template,omitempty"`    // text/template of the message. Defaults to defaultNotifierTemplate
+	Data        map[string]string `json:"data"`
+
+	GroupWait      string `json:"groupWait,omitempty"`      // changes of statuses with the same parent within this duration are sent together
+	RepeatInterval string `json:"repeatInterval,omitempty"` // statuses which are still not good are sent again after this duration
+	RateLimit      string `json:"rateLimit,omitempty"`      // most notifications sent within a duration like 10/1h
+}
+
+// NotifierFactory describes a type of notifier and how to create it
+type NotifierFactory struct {
+	Type         string
+	RequiredKeys []string // keys required in NotifierDef.Data
+	New          func(def NotifierDef) (Notifier, error)
+}
+
+// Notification is a status transition sent to a notifier. It is also the json body of webhooks
+type Notification struct {
+	ID        string      `json:"id"`       // full id of the status
+	FullName  string      `json:"fullName"` // full names from the top parent to the status like 'Production / Website'
+	URL       string      `json:"url,omitempty"`
+	Status    StatusValue `json:"status"`
+	Previous  StatusValue `json:"previous"`
+	Message   string      `json:"message,omitempty"`
+	Source    string      `json:"source,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Text      string      `json:"text"` // rendered from the template of the notifier
+
+	Grouped    []Notification `json:"grouped,omitempty"`    // the changes of the children if several were sent together
+	Repeat     bool           `json:"repeat,omitempty"`     // whether this is a reminder of a status which is still not good
+	Suppressed int            `json:"suppressed,omitempty"` // notifications dropped by the rate limit since the last one sent
+
+	group     string // full id of the parent the notification is grouped by. The status itself at the top
+	groupName string
+	matched   bool // whether the change matches the transitions of the notifier. Others are only tracked, not sent
+}
+
+// statusTransition is a change of status a notifier is sent. StatusNone matches any status
+type statusTransition struct {
+	from StatusValue
+	to   StatusValue
+}
+
+// matches returns whether the change is the transition. The first status set is never a transition so
+// a restarting dashboard does not notify about everything
+func (st statusTransition) matches(old, new StatusValue) bool {
+	return old != StatusNone && (st.from == StatusNone || st.from == old) && (st.to == StatusNone || st.to == new)
+}
+
+var notifierFactories = map[string]NotifierFactory{}
+
+// RegisterNotifierFactory makes a notifier type available to notifier definitions. Notifier types register themselves in init
+func RegisterNotifierFactory(factory NotifierFactory) {
+	if _, ok := notifierFactories[factory.Type]; ok {
+		panic("Notifier type registered twice: " + factory.Type)
+	}
+	notifierFactories[factory.Type] = factory
+}
+
+// SupportedNotifierTypes returns the sorted names of all registered notifier types
+func SupportedNotifierTypes() []string {
+	types := []string{}
+	for t := range notifierFactories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// parseTransition parses a transition like good->bad. Either side can be * to match any status
+func parseTransition(value string) (statusTransition, error) {
+	parts := strings.Split(value, transitionArrow)
+	if len(parts) != 2 {
+		return statusTransition{}, fmt.Errorf("invalid transition '%s'. Must be like good->bad or *->good", value)
+	}
+	values := [2]StatusValue{}
+	for i, part := range parts {
+		if strings.TrimSpace(part) == anyStatus {
+			continue
+		}
+		sv, err := ParseStatusValue(part)
+		if err != nil {
+			return statusTransition{}, fmt.Errorf("invalid transition '%s'. Must be like good->bad or *->good", value)
+		}
+		values[i] = sv
+	}
+	return statusTransition{from: values[0], to: values[1]}, nil
+}
+
+// parseNotificationTemplate parses the template and renders an empty notification so unknown fields are found up front
+func parseNotificationTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, Notification{})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// notifierRoute is a created notifier with the transitions it is sent. Each notifier has its own queue
+// so a slow one does not hold up the others or the status updates
+type notifierRoute struct {
+	id          string
+	notifier    Notifier
+	transitions []statusTransition
+	template    *template.Template
+	policy      notifierPolicy
+	queue       chan Notification
+
+	// what was seen and sent, only used by run
+	lastSeen   map[string]StatusValue        // key: status id
+	active     map[string]*activeAlert       // key: status id
+	groups     map[string]*notificationGroup // key: group id
+	sentTimes  []time.Time                   // within the rate period
+	suppressed int
+
+	previous *notifierRoute // the notifier with the same id this one replaced on reload
+	replaced bool           // set before the queue is closed if a new notifier takes over
+	done     chan bool      // closed once run returns
+}
+
+func newNotifierRoute(def NotifierDef) (*notifierRoute, error) {
+	factory, ok := notifierFactories[def.Type]
+	if !ok {
+		return nil, fmt.Errorf("Unknown notifier type '%s' for notifier %s. Supported types: %s", def.Type, def.ID, strings.Join(SupportedNotifierTypes(), ", "))
+	}
+	err := checkForMapKeys(def.Data, factory.RequiredKeys)
+	if err != nil {
+		return nil, fmt.Errorf("Error making notifier %s with error: %s", def.ID, err.Error())
+	}
+	transitions := def.Transitions
+	if len(transitions) == 0 {
+		transitions = defaultNotifierTransitions
+	}
+	route := &notifierRoute{
+		id:       def.ID,
+		queue:    make(chan Notification, notifierQueueSize),
+		lastSeen: map[string]StatusValue{},
+		active:   map[string]*activeAlert{},
+		groups:   map[string]*notificationGroup{},
+		done:     make(chan bool),
+	}
+	route.policy, err = newNotifierPolicy(def)
+	if err != nil {
+		return nil, fmt.Errorf("Error making notifier %s with error: %s", def.ID, err.Error())
+	}
+	for _, value := range transitions {
+		transition, err := parseTransition(value)
+		if err != nil {
+			return nil, fmt.Errorf("Error making notifier %s with error: %s", def.ID, err.Error())
+		}
+		route.transitions = append(route.transitions, transition)
+	}
+	text := def.Template
+	if text == "" {
+		text = defaultNotifierTemplate
+	}
+	route.template, err = parseNotificationTemplate(def.ID, text)
+	if err != nil {
+		return nil, fmt.Errorf("Error making notifier %s with error: %s", def.ID, err.Error())
+	}
+	route.notifier, err = factory.New(def)
+	if err != nil {
+		return nil, fmt.Errorf("Error making notifier %s with error: %s", def.ID, err.Error())
+	}
+	return route, nil
+}
+
+func (nr *notifierRoute) matches(old, new StatusValue) bool {
+	for _, transition := range nr.transitions {
+		if transition.matches(old, new) {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifications sends status transitions to the notifiers the statuses are routed to
+type Notifications struct {
+	lock   sync.RWMutex
+	routes map[string]*notifierRoute // key: notifier id
+}
+
+// NewNotifications returns notifications without any notifiers
+func NewNotifications() *Notifications {
+	return &Notifications{routes: map[string]*notifierRoute{}}
+}
+
+// Replace creates the notifiers and swaps them in for the current ones. If any cannot be created nothing is changed
+func (n *Notifications) Replace(defs []NotifierDef) error {
+	routes, err := newNotifierRoutes(defs)
+	if err != nil {
+		return err
+	}
+	n.swap(routes)
+	return nil
+}
+
+// newNotifierRoutes creates a route for every notifier without running them. Key: notifier id
+func newNotifierRoutes(defs []NotifierDef) (map[string]*notifierRoute, error) {
+	routes := map[string]*notifierRoute{}
+	for _, def := range defs {
+		route, err := newNotifierRoute(def)
+		if err != nil {
+			return nil, err
+		}
+		routes[def.ID] = route
+	}
+	return routes, nil
+}
+
+// swap runs the routes in place of the current ones. Notifications already queued for the current notifiers
+// are still sent and notifiers keeping their id keep what they sent
+func (n *Notifications) swap(routes map[string]*notifierRoute) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	for id, route := range n.routes {
+		if replacement, ok := routes[id]; ok {
+			replacement.previous = route
+			route.replaced = true
+		}
+		close(route.queue)
+	}
+	n.routes = routes
+	for _, route := range routes {
+		go route.run()
+	}
+}
+
+// Notify queues the notification for the notifiers. Every change is queued so the notifiers know the latest status
+// but only those with a matching transition are sent. It never blocks so it can be called while holding the monitor lock.
+// Secrets are redacted before the message is rendered
+func (n *Notifications) Notify(notifierIDs []string, notification Notification) {
+	notification.FullName = secrets.redactField(notification.FullName)
+	notification.URL = secrets.redactField(notification.URL)
+	notification.Message = secrets.redact(notification.Message)
+
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	for _, id := range notifierIDs {
+		route, ok := n.routes[id]
+		if !ok {
+			continue
+		}
+		routed := notification
+		routed.matched = route.matches(notification.Previous, notification.Status)
+		if routed.matched {
+			var text bytes.Buffer
+			err := route.template.Execute(&text, notification)
+			if err != nil {
+				logger.Error("Could not render notification", "notifier", id, "id", notification.ID, "error", err)
+				continue
+			}
+			routed.Text = secrets.redact(text.String())
+		}
+		select {
+		case route.queue <- routed:
+		default:
+			logger.Error("Notification queue is full, dropping notification", "notifier", id, "id", notification.ID)
+		}
+	}
+}
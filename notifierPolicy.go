@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	rateLimitDelimiter = "/"
+	reminderPrefix     = "Reminder: "
+)
+
+// notifierPolicy is how a notifier groups, repeats and limits the notifications it sends
+type notifierPolicy struct {
+	groupWait      time.Duration // how long changes of statuses with the same parent are collected. 0 sends each change on its own
+	repeatInterval time.Duration // how often statuses which are still not good are sent again. 0 never repeats
+	rateLimit      int           // most notifications sent within ratePeriod. 0 is unlimited
+	ratePeriod     time.Duration
+}
+
+// activeAlert is a status last sent as not good
+type activeAlert struct {
+	notification Notification
+	notified     time.Time // when it was last sent, repeats are sent repeatInterval after
+}
+
+// notificationGroup collects the changes of the children of a parent status so they are sent as one notification
+type notificationGroup struct {
+	id       string
+	name     string
+	pending  []Notification // the latest change of each status
+	flushAt  time.Time      // zero if nothing is pending
+	resolved []Notification // recoveries held until every status of the group is good again
+}
+
+func newNotifierPolicy(def NotifierDef) (notifierPolicy, error) {
+	var policy notifierPolicy
+	var err error
+	policy.groupWait, err = parseNotifierDuration(def.GroupWait)
+	if err != nil {
+		return policy, fmt.Errorf("Invalid groupWait: %s", err.Error())
+	}
+	policy.repeatInterval, err = parseNotifierDuration(def.RepeatInterval)
+	if err != nil {
+		return policy, fmt.Errorf("Invalid repeatInterval: %s", err.Error())
+	}
+	policy.rateLimit, policy.ratePeriod, err = parseRateLimit(def.RateLimit)
+	if err != nil {
+		return policy, fmt.Errorf("Invalid rateLimit: %s", err.Error())
+	}
+	return policy, nil
+}
+
+// parseNotifierDuration parses an optional duration which must be greater than 0 if given
+func parseNotifierDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid duration '%s'", value)
+	}
+	return duration, nil
+}
+
+// parseRateLimit parses an optional rate limit like 10/1h for at most 10 notifications an hour
+func parseRateLimit(value string) (int, time.Duration, error) {
+	if value == "" {
+		return 0, 0, nil
+	}
+	invalid := fmt.Errorf("invalid rate limit '%s'. Must be like 10/1h", value)
+	parts := strings.Split(value, rateLimitDelimiter)
+	if len(parts) != 2 {
+		return 0, 0, invalid
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit <= 0 {
+		return 0, 0, invalid
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || period <= 0 {
+		return 0, 0, invalid
+	}
+	return limit, period, nil
+}
+
+// run sends the queued notifications until the queue is closed. The state of what was sent is only used by this goroutine.
+// A notifier replaced by one with the same id on reload hands its state over so the new one carries on where it left off,
+// otherwise any pending group is sent before returning
+func (nr *notifierRoute) run() {
+	defer close(nr.done)
+	if nr.previous != nil {
+		<-nr.previous.done
+		nr.lastSeen = nr.previous.lastSeen
+		nr.active = nr.previous.active
+		nr.groups = nr.previous.groups
+		nr.sentTimes = nr.previous.sentTimes
+		nr.suppressed = nr.previous.suppressed
+		nr.previous = nil
+	}
+	for {
+		var wake <-chan time.Time
+		if next, ok := nr.nextWake(); ok {
+			wake = time.After(time.Until(next))
+		}
+		select {
+		case n, ok := <-nr.queue:
+			if !ok {
+				if !nr.replaced {
+					nr.flushGroups(time.Time{})
+				}
+				return
+			}
+			nr.add(n, time.Now())
+		case now := <-wake:
+			nr.flushGroups(now)
+			nr.repeat(now)
+		}
+	}
+}
+
+// nextWake returns when the next group is due or the next status is to be repeated
+func (nr *notifierRoute) nextWake() (time.Time, bool) {
+	var next time.Time
+	earliest := func(t time.Time) {
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	for _, group := range nr.groups {
+		earliest(group.flushAt)
+	}
+	if nr.policy.repeatInterval > 0 {
+		for _, alert := range nr.active {
+			earliest(alert.notified.Add(nr.policy.repeatInterval))
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// add sends the change right away or adds it to the group of its parent
+func (nr *notifierRoute) add(n Notification, now time.Time) {
+	if nr.policy.groupWait == 0 {
+		if nr.isDuplicate(n) {
+			return
+		}
+		nr.record(n, now)
+		if n.matched {
+			nr.deliver(n, now)
+		}
+		return
+	}
+	group, ok := nr.groups[n.group]
+	if !ok {
+		group = &notificationGroup{id: n.group, name: n.groupName}
+		nr.groups[n.group] = group
+	}
+	if group.flushAt.IsZero() {
+		group.flushAt = now.Add(nr.policy.groupWait)
+	}
+	for i, pending := range group.pending {
+		if pending.ID == n.ID {
+			group.pending = append(group.pending[:i], group.pending[i+1:]...)
+			break
+		}
+	}
+	group.pending = append(group.pending, n)
+}
+
+// isDuplicate returns whether the status is the last one seen. A status going bad and back within a group is not sent at all
+func (nr *notifierRoute) isDuplicate(n Notification) bool {
+	last, ok := nr.lastSeen[n.ID]
+	if ok && last == n.Status {
+		logger.Debug("Dropping duplicate notification", "notifier", nr.id, "id", n.ID, "status", n.Status)
+		return true
+	}
+	return false
+}
+
+// record remembers the change so duplicates are dropped and statuses sent as not good are repeated until they change.
+// A change which is not sent, like a recovery the notifier does not want, still stops the repeats
+func (nr *notifierRoute) record(n Notification, now time.Time) {
+	nr.lastSeen[n.ID] = n.Status
+	if n.matched && n.Status != StatusGood {
+		nr.active[n.ID] = &activeAlert{notification: n, notified: now}
+	} else {
+		delete(nr.active, n.ID)
+	}
+}
+
+// flushGroups sends the groups due by now. A zero now sends every pending group. Changes to a status which is not good
+// are sent together. Recoveries are held until no status of the group is still not good and then sent as one resolved notification
+func (nr *notifierRoute) flushGroups(now time.Time) {
+	all := now.IsZero()
+	if all {
+		now = time.Now()
+	}
+	for _, group := range nr.groups {
+		if group.flushAt.IsZero() || (!all && group.flushAt.After(now)) {
+			continue
+		}
+		problems := []Notification{}
+		for _, n := range group.pending {
+			if nr.isDuplicate(n) {
+				continue
+			}
+			wasActive := nr.active[n.ID] != nil
+			nr.record(n, now)
+			for i, resolved := range group.resolved {
+				if resolved.ID == n.ID {
+					group.resolved = append(group.resolved[:i], group.resolved[i+1:]...)
+					break
+				}
+			}
+			// a status going bad and back within the group was never sent so its recovery is not either
+			switch {
+			case !n.matched:
+			case n.Status != StatusGood:
+				problems = append(problems, n)
+			case wasActive:
+				group.resolved = append(group.resolved, n)
+			}
+		}
+		group.pending = nil
+		group.flushAt = time.Time{}
+
+		if len(problems) > 0 {
+			nr.deliver(groupNotification(group, fmt.Sprintf("%s: %d statuses changed", group.name, len(problems)), problems), now)
+		}
+		if len(group.resolved) > 0 && !nr.groupHasActive(group.id) {
+			nr.deliver(groupNotification(group, fmt.Sprintf("%s: resolved", group.name), group.resolved), now)
+			group.resolved = nil
+		}
+	}
+}
+
+func (nr *notifierRoute) groupHasActive(groupID string) bool {
+	for _, alert := range nr.active {
+		if alert.notification.group == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// repeat sends the statuses which are still not good repeatInterval after they were last sent. Statuses of the same
+// parent are sent together if the notifier groups
+func (nr *notifierRoute) repeat(now time.Time) {
+	if nr.policy.repeatInterval == 0 {
+		return
+	}
+	due := map[string][]Notification{} // key: group id or status id if not grouping
+	groups := map[string]*notificationGroup{}
+	for id, alert := range nr.active {
+		if alert.notified.Add(nr.policy.repeatInterval).After(now) {
+			continue
+		}
+		alert.notified = now
+		key := id
+		if nr.policy.groupWait > 0 {
+			key = alert.notification.group
+			groups[key] = &notificationGroup{id: key, name: alert.notification.groupName}
+		}
+		due[key] = append(due[key], alert.notification)
+	}
+	for key, notifications := range due {
+		var n Notification
+		if group, ok := groups[key]; ok {
+			n = groupNotification(group, fmt.Sprintf("%s: %d statuses are still not good", group.name, len(notifications)), notifications)
+		} else {
+			n = notifications[0]
+		}
+		n.Repeat = true
+		n.Text = reminderPrefix + n.Text
+		nr.deliver(n, now)
+	}
+}
+
+// groupNotification returns the notification if there is only one, otherwise a notification of the parent with the worst
+// status and every change listed in the message after the header
+func groupNotification(group *notificationGroup, header string, notifications []Notification) Notification {
+	if len(notifications) == 1 {
+		return notifications[0]
+	}
+	n := Notification{
+		ID:       group.id,
+		FullName: group.name,
+		Grouped:  notifications,
+		group:    group.id,
+	}
+	lines := []string{header}
+	for _, grouped := range notifications {
+		if grouped.Status.WorseThan(n.Status) || n.Status == StatusNone {
+			n.Status = grouped.Status
+		}
+		if grouped.Previous.WorseThan(n.Previous) {
+			n.Previous = grouped.Previous
+		}
+		if grouped.Timestamp.After(n.Timestamp) {
+			n.Timestamp = grouped.Timestamp
+		}
+		lines = append(lines, grouped.Text)
+	}
+	n.Text = strings.Join(lines, "\n")
+	return n
+}
+
+// deliver sends the notification unless the rate limit is reached. The next notification sent has how many were dropped
+func (nr *notifierRoute) deliver(n Notification, now time.Time) {
+	if nr.policy.rateLimit > 0 {
+		recent := nr.sentTimes[:0]
+		for _, sent := range nr.sentTimes {
+			if now.Sub(sent) < nr.policy.ratePeriod {
+				recent = append(recent, sent)
+			}
+		}
+		nr.sentTimes = recent
+		if len(nr.sentTimes) >= nr.policy.rateLimit {
+			nr.suppressed++
+			logger.Warning("Notification rate limit reached, dropping notification", "notifier", nr.id, "id", n.ID)
+			return
+		}
+		nr.sentTimes = append(nr.sentTimes, now)
+	}
+	if nr.suppressed > 0 {
+		n.Suppressed = nr.suppressed
+		n.Text += fmt.Sprintf("\n(%d notifications were dropped by the rate limit)", nr.suppressed)
+		nr.suppressed = 0
+	}
+	err := nr.notifier.Notify(n)
+	if err != nil {
+		logger.Error("Could not send notification", "notifier", nr.id, "id", n.ID, "error", err)
+	}
+}
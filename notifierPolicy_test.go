@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NotifierPolicy", func() {
+	var server *httptest.Server
+	var received chan Notification
+	var notifications *Notifications
+
+	BeforeEach(func() {
+		received = make(chan Notification, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			var n Notification
+			Expect(json.NewDecoder(r.Body).Decode(&n)).To(Succeed())
+			received <- n
+		}))
+		notifications = NewNotifications()
+	})
+
+	AfterEach(func() {
+		Expect(notifications.Replace(nil)).To(Succeed())
+		server.Close()
+	})
+
+	setPolicy := func(def NotifierDef) {
+		def.ID = "ops"
+		def.Type = WebhookType
+		if def.Transitions == nil {
+			def.Transitions = []string{"*->*"}
+		}
+		def.Template = "{{.ID}} is {{.Status}}"
+		def.Data = map[string]string{NotifierURLKey: server.URL}
+		Expect(notifications.Replace([]NotifierDef{def})).To(Succeed())
+	}
+
+	// change sends a change of a child of prod
+	change := func(id string, old, new StatusValue) {
+		notifications.Notify([]string{"ops"}, Notification{
+			ID:        "prod#" + id,
+			FullName:  "Production / " + id,
+			Status:    new,
+			Previous:  old,
+			Timestamp: time.Now(),
+			group:     "prod",
+			groupName: "Production",
+		})
+	}
+
+	texts := func(notifications []Notification) []string {
+		texts := []string{}
+		for _, n := range notifications {
+			texts = append(texts, n.Text)
+		}
+		return texts
+	}
+
+	Describe("Given a notifier grouping by parent", func() {
+		BeforeEach(func() {
+			setPolicy(NotifierDef{GroupWait: "100ms"})
+		})
+
+		Context("When several children change within the window", func() {
+			It("Then they should be sent as one notification and resolved once all recover", func() {
+				change("web", StatusGood, StatusBad)
+				change("api", StatusGood, StatusBad)
+				change("db", StatusGood, StatusDegraded)
+				var n Notification
+				Eventually(received).Should(Receive(&n))
+				Expect(n.ID).To(Equal("prod"))
+				Expect(n.FullName).To(Equal("Production"))
+				Expect(n.Status).To(Equal(StatusBad))
+				Expect(n.Text).To(Equal("Production: 3 statuses changed\nprod#web is bad\nprod#api is bad\nprod#db is degraded"))
+				Expect(texts(n.Grouped)).To(Equal([]string{"prod#web is bad", "prod#api is bad", "prod#db is degraded"}))
+
+				change("web", StatusBad, StatusGood)
+				change("api", StatusBad, StatusGood)
+				Consistently(received, 300*time.Millisecond).ShouldNot(Receive())
+				change("db", StatusDegraded, StatusGood)
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Status).To(Equal(StatusGood))
+				Expect(n.Text).To(Equal("Production: resolved\nprod#web is good\nprod#api is good\nprod#db is good"))
+			})
+		})
+		Context("When a child goes bad and back within the window", func() {
+			It("Then nothing should be sent", func() {
+				change("web", StatusGood, StatusBad)
+				change("web", StatusBad, StatusGood)
+				Consistently(received, 300*time.Millisecond).ShouldNot(Receive())
+			})
+		})
+		Context("When the notifier is replaced by one with the same id", func() {
+			It("Then the new one should know what was sent", func() {
+				change("web", StatusGood, StatusBad)
+				Eventually(received).Should(Receive())
+				setPolicy(NotifierDef{GroupWait: "50ms"})
+				change("web", StatusBad, StatusGood)
+				var n Notification
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Text).To(Equal("prod#web is good"))
+			})
+		})
+	})
+
+	Describe("Given a notifier which does not group", func() {
+		Context("When a status is sent again with the same status", func() {
+			It("Then the duplicate should be dropped", func() {
+				setPolicy(NotifierDef{})
+				change("web", StatusGood, StatusBad)
+				change("web", StatusDegraded, StatusBad)
+				Eventually(received).Should(Receive())
+				Consistently(received, 200*time.Millisecond).ShouldNot(Receive())
+			})
+		})
+	})
+
+	Describe("Given a notifier with a repeat interval", func() {
+		Context("When a status stays bad", func() {
+			It("Then a reminder should be sent until it recovers", func() {
+				setPolicy(NotifierDef{RepeatInterval: "150ms"})
+				change("web", StatusGood, StatusBad)
+				Eventually(received).Should(Receive())
+				var n Notification
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Repeat).To(BeTrue())
+				Expect(n.Text).To(Equal("Reminder: prod#web is bad"))
+
+				change("web", StatusBad, StatusGood)
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Text).To(Equal("prod#web is good"))
+				Consistently(received, 300*time.Millisecond).ShouldNot(Receive())
+			})
+		})
+	})
+
+	Describe("Given a notifier only sent some transitions", func() {
+		Context("When a status goes bad, degraded and bad again", func() {
+			It("Then it should be sent both times it went bad", func() {
+				setPolicy(NotifierDef{Transitions: []string{"*->bad"}})
+				change("web", StatusGood, StatusBad)
+				change("web", StatusBad, StatusDegraded)
+				change("web", StatusDegraded, StatusBad)
+				var n Notification
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Previous).To(Equal(StatusGood))
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Previous).To(Equal(StatusDegraded))
+				Consistently(received, 200*time.Millisecond).ShouldNot(Receive())
+			})
+		})
+		Context("When a status repeated while bad recovers", func() {
+			It("Then the reminders should stop without sending the recovery", func() {
+				setPolicy(NotifierDef{Transitions: []string{"*->bad"}, RepeatInterval: "150ms"})
+				change("web", StatusGood, StatusBad)
+				Eventually(received).Should(Receive())
+				var n Notification
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Repeat).To(BeTrue())
+
+				change("web", StatusBad, StatusGood)
+				Consistently(received, 400*time.Millisecond).ShouldNot(Receive())
+			})
+		})
+	})
+
+	Describe("Given a notifier with a rate limit", func() {
+		Context("When more notifications are sent than the limit", func() {
+			It("Then the rest should be dropped and counted in the next one", func() {
+				setPolicy(NotifierDef{RateLimit: "2/300ms"})
+				for _, id := range []string{"web", "api", "db", "cache"} {
+					change(id, StatusGood, StatusBad)
+				}
+				Eventually(received).Should(Receive())
+				Eventually(received).Should(Receive())
+				Consistently(received, 200*time.Millisecond).ShouldNot(Receive())
+
+				time.Sleep(300 * time.Millisecond)
+				change("queue", StatusGood, StatusBad)
+				var n Notification
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Suppressed).To(Equal(2))
+				Expect(n.Text).To(Equal("prod#queue is bad\n(2 notifications were dropped by the rate limit)"))
+			})
+		})
+	})
+
+	Describe("Given invalid policies", func() {
+		Context("When they are parsed", func() {
+			It("Then they should error", func() {
+				_, err := newNotifierPolicy(NotifierDef{GroupWait: "soon"})
+				Expect(err).To(MatchError("Invalid groupWait: invalid duration 'soon'"))
+				_, err = newNotifierPolicy(NotifierDef{RepeatInterval: "-1h"})
+				Expect(err).To(MatchError("Invalid repeatInterval: invalid duration '-1h'"))
+				for _, value := range []string{"10", "ten/1h", "0/1h", "10/soon"} {
+					_, err = newNotifierPolicy(NotifierDef{RateLimit: value})
+					Expect(err).To(MatchError("Invalid rateLimit: invalid rate limit '"+value+"'. Must be like 10/1h"), value)
+				}
+				limit, period, err := parseRateLimit("10/1h")
+				Expect(err).To(BeNil())
+				Expect(limit).To(Equal(10))
+				Expect(period).To(Equal(time.Hour))
+			})
+		})
+	})
+})
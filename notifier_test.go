@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Notifications", func() {
+	var server *httptest.Server
+	var received chan Notification
+	var m *Monitor
+
+	BeforeEach(func() {
+		received = make(chan Notification, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			var n Notification
+			Expect(json.NewDecoder(r.Body).Decode(&n)).To(Succeed())
+			received <- n
+		}))
+		m = NewMonitor(&MonitorConfig{
+			Router: mux.NewRouter(),
+			Statuses: []*Status{
+				{
+					ID:       "prod",
+					FullName: "Production",
+					Rollup:   &Rollup{Mode: RollupWorst},
+					Notify:   []string{"ops"},
+					Children: []*Status{
+						{ID: "web", FullName: "Website", URL: "https://example.com", Notify: []string{"ops", "web-team"}},
+						{ID: "api", FullName: "API"},
+					},
+				},
+				{ID: "dev"},
+			},
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	update := func(id string, status StatusValue, message string) {
+		Expect(m.UpdateStatusByID(StatusUpdate{ID: id, Status: status, Message: message, Source: "http"})).To(Succeed())
+	}
+
+	Describe("Given statuses routed to notifiers", func() {
+		Context("When a status changes with the default transitions", func() {
+			It("Then only going bad and recovering from bad should be sent", func() {
+				Expect(m.SetNotifiers([]NotifierDef{{ID: "ops", Type: WebhookType, Data: map[string]string{NotifierURLKey: server.URL}}})).To(Succeed())
+				update("prod#web", StatusGood, "")
+				update("prod#web", StatusBad, "500 Internal Server Error")
+
+				var n Notification
+				Eventually(received).Should(Receive(&n))
+				Expect(n.ID).To(Equal("prod#web"))
+				Expect(n.FullName).To(Equal("Production / Website"))
+				Expect(n.URL).To(Equal("https://example.com"))
+				Expect(n.Status).To(Equal(StatusBad))
+				Expect(n.Previous).To(Equal(StatusGood))
+				Expect(n.Source).To(Equal("http"))
+				Expect(n.Text).To(Equal("Production / Website is bad (was good): 500 Internal Server Error https://example.com"))
+
+				// the roll-up of the parent changes at the same time
+				Eventually(received).Should(Receive(&n))
+				Expect(n.ID).To(Equal("prod"))
+				Expect(n.Source).To(Equal(rollupSource))
+				Expect(n.Text).To(Equal("Production is bad (was good)"))
+
+				// going bad again after being degraded is sent again
+				update("prod#web", StatusDegraded, "slow")
+				update("prod#web", StatusBad, "")
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Text).To(HavePrefix("Production / Website is bad (was degraded)"))
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Text).To(Equal("Production is bad (was degraded)"))
+				Consistently(received, 200*time.Millisecond).ShouldNot(Receive())
+				update("prod#web", StatusGood, "")
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Text).To(HavePrefix("Production / Website is good (was bad)"))
+			})
+		})
+		Context("When a notifier has its own transitions and template", func() {
+			It("Then the transitions should be matched and the message rendered with the template", func() {
+				Expect(m.SetNotifiers([]NotifierDef{{
+					ID:          "web-team",
+					Type:        WebhookType,
+					Transitions: []string{"good->*"},
+					Template:    "{{.ID}}: {{.Previous}} -> {{.Status}}",
+					Data:        map[string]string{NotifierURLKey: server.URL},
+				}})).To(Succeed())
+				update("prod#web", StatusGood, "")
+				update("prod#web", StatusDegraded, "")
+				var n Notification
+				Eventually(received).Should(Receive(&n))
+				Expect(n.Text).To(Equal("prod#web: good -> degraded"))
+
+				update("prod#web", StatusBad, "")
+				update("prod#api", StatusGood, "")
+				update("prod#api", StatusBad, "")
+				Consistently(received, 200*time.Millisecond).ShouldNot(Receive())
+			})
+		})
+		Context("When a status is not routed to any notifier", func() {
+			It("Then nothing should be sent", func() {
+				Expect(m.SetNotifiers([]NotifierDef{{ID: "ops", Type: WebhookType, Data: map[string]string{NotifierURLKey: server.URL}}})).To(Succeed())
+				update("dev", StatusGood, "")
+				update("dev", StatusBad, "")
+				Consistently(received, 200*time.Millisecond).ShouldNot(Receive())
+			})
+		})
+		Context("When the notifiers cannot be created", func() {
+			It("Then the current notifiers should be kept", func() {
+				Expect(m.SetNotifiers([]NotifierDef{{ID: "ops", Type: WebhookType, Data: map[string]string{NotifierURLKey: server.URL}}})).To(Succeed())
+				Expect(m.SetNotifiers([]NotifierDef{{ID: "ops", Type: "Pager"}})).To(MatchError(ContainSubstring("Unknown notifier type 'Pager'")))
+				Expect(m.SetNotifiers([]NotifierDef{{ID: "ops", Type: SlackType}})).To(MatchError(ContainSubstring("Missing required key: url")))
+				Expect(m.SetNotifiers([]NotifierDef{{ID: "ops", Type: WebhookType, Transitions: []string{"good=>bad"}, Data: map[string]string{NotifierURLKey: server.URL}}})).ToNot(Succeed())
+				update("prod#api", StatusGood, "")
+				update("prod#api", StatusBad, "")
+				Eventually(received).Should(Receive())
+			})
+		})
+	})
+
+	Describe("Given a config with invalid notifiers", func() {
+		Context("When it is validated", func() {
+			It("Then every problem should have its path", func() {
+				err := validateConfiguration(Configuration{
+					Notifiers: []NotifierDef{
+						{ID: "slack", Type: SlackType, Transitions: []string{"good->fine"}, Template: "{{.Name}}"},
+						{ID: "slack", Type: WebhookType},
+						{ID: "pager", Type: "Pager"},
+					},
+					Statuses: []*Status{{ID: "prod", Notify: []string{"slack", "email"}}},
+				})
+				Expect(err).To(BeAssignableToTypeOf(ConfigError{}))
+				Expect(err.(ConfigError).Problems).To(Equal([]ConfigProblem{
+					{"notifiers[0].data.url", "required by Slack notifiers"},
+					{"notifiers[0].transitions[0]", "invalid transition 'good->fine'. Must be like good->bad or *->good"},
+					{"notifiers[0].template", `template: slack:1:2: executing "slack" at <.Name>: can't evaluate field Name in type main.Notification`},
+					{"notifiers[1].id", "duplicate notifier id 'slack'"},
+					{"notifiers[2].type", "unknown notifier type 'Pager'. Supported types: SMTP, Slack, Webhook"},
+					{"statuses[0].notify[1]", "undefined notifier 'email'"},
+				}))
+			})
+		})
+	})
+})
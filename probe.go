@@ -1,11 +1,17 @@
 package main
 
 import (
-	"errors"
-	"os"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
+const (
+	ProbeIntervalKey = "interval"
+)
+
 type Probe interface {
 	Start()
 	Stop()
@@ -24,42 +30,144 @@ type ProbeRef struct {
 	Data  map[string]string `json:"data"`
 }
 
+// MarshalJSON hides any secret in the data such as api keys
+func (pr ProbeRef) MarshalJSON() ([]byte, error) {
+	type probeRef ProbeRef // without the MarshalJSON method
+	redacted := probeRef{RefID: pr.RefID}
+	if pr.Data != nil {
+		redacted.Data = map[string]string{}
+		for key, value := range pr.Data {
+			redacted.Data[key] = secrets.redactField(value)
+		}
+	}
+	return json.Marshal(redacted)
+}
+
+// ProbeConfig is the common configuration given to a ProbeFactory to create a probe
+type ProbeConfig struct {
+	ID       string
+	Data     map[string]string
+	Interval time.Duration // parsed from the 'interval' data key if given
+	Update   chan StatusUpdate
+	Health   chan ProbeReport // every poll should be reported here so probe errors show up on the dashboard
+}
+
+// ProbeFactory describes a type of probe and how to create it
+type ProbeFactory struct {
+	Type            string
+	RequiredDefKeys []string // keys required in ProbeDef.Data
+	RequiredRefKeys []string // keys required in ProbeRef.Data of every status referencing the probe
+	New             func(config ProbeConfig, statuses []*Status) (Probe, error)
+}
+
+var probeFactories = map[string]ProbeFactory{}
+
+// RegisterProbeFactory makes a probe type available to CreateProbes. Probe types register themselves in init
+func RegisterProbeFactory(factory ProbeFactory) {
+	if _, ok := probeFactories[factory.Type]; ok {
+		panic("Probe type registered twice: " + factory.Type)
+	}
+	probeFactories[factory.Type] = factory
+}
+
+// SupportedProbeTypes returns the sorted names of all registered probe types
+func SupportedProbeTypes() []string {
+	types := []string{}
+	for t := range probeFactories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
 // CreateProbes create the probes defined in the config
-func CreateProbes(probeDefs []ProbeDef, statuses []*Status, updateChan chan StatusUpdate) ([]Probe, error) {
+func CreateProbes(probeDefs []ProbeDef, statuses []*Status, updateChan chan StatusUpdate, healthChan chan ProbeReport) ([]Probe, error) {
 	probes := []Probe{}
-	for _, probe := range probeDefs {
-		switch probe.Type {
-		case NewRelicType:
-			logger.Debug("Creating new probe", "refID", probe.ID, "type", probe.Type)
-			err := checkForMapKeys(probe.Data, []string{NewRelicIntervalKey, NewRelicAPIEnvKey, NewRelicAccountNumberKey})
-			if err != nil {
-				return nil, errors.New("Error making probe " + probe.ID + " with error: " + err.Error())
-			}
-			probeInterval, err := time.ParseDuration(probe.Data[NewRelicIntervalKey])
-			if err != nil {
-				return nil, err
-			}
-			nrpc := &NewRelicProbeConfig{
-				id:       probe.ID,
-				update:   updateChan,
-				interval: probeInterval,
-				key:      os.Getenv(probe.Data[NewRelicAPIEnvKey]),
-				account:  probe.Data[NewRelicAccountNumberKey],
-			}
-			nrp := NewNewRelicProbe(nrpc)
-			err = nrp.Initialize(statuses)
-			if err != nil {
-				logger.Critical("Could not initialize New Relic probe")
-				return nil, err
-			}
-			probes = append(probes, nrp)
-		default:
-			logger.Critical("Unknown probe type", "probe type", probe.Type)
+	for _, def := range probeDefs {
+		factory, ok := probeFactories[def.Type]
+		if !ok {
+			return nil, fmt.Errorf("Unknown probe type '%s' for probe %s. Supported types: %s", def.Type, def.ID, strings.Join(SupportedProbeTypes(), ", "))
+		}
+		logger.Debug("Creating new probe", "refID", def.ID, "type", def.Type)
+		config, err := newProbeConfig(def, factory, statuses, updateChan, healthChan)
+		if err != nil {
+			return nil, fmt.Errorf("Error making probe %s with error: %s", def.ID, err.Error())
+		}
+		probe, err := factory.New(config, statuses)
+		if err != nil {
+			logger.Critical("Could not initialize probe", "refID", def.ID, "type", def.Type)
+			return nil, fmt.Errorf("Error initializing probe %s with error: %s", def.ID, err.Error())
 		}
+		probes = append(probes, probe)
 	}
 	return probes, nil
 }
 
+// newProbeConfig checks the required keys of the probe definition and the statuses referencing it
+func newProbeConfig(def ProbeDef, factory ProbeFactory, statuses []*Status, updateChan chan StatusUpdate, healthChan chan ProbeReport) (ProbeConfig, error) {
+	err := checkForMapKeys(def.Data, factory.RequiredDefKeys)
+	if err != nil {
+		return ProbeConfig{}, err
+	}
+	err = forEachProbeRef(def.ID, statuses, func(fullStatusID string, s *Status) error {
+		err := checkForMapKeys(s.Probe.Data, factory.RequiredRefKeys)
+		if err != nil {
+			return fmt.Errorf("status %s: %s", fullStatusID, err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return ProbeConfig{}, err
+	}
+
+	config := ProbeConfig{
+		ID:     def.ID,
+		Data:   def.Data,
+		Update: updateChan,
+		Health: healthChan,
+	}
+	if def.Data[ProbeIntervalKey] != "" {
+		config.Interval, err = time.ParseDuration(def.Data[ProbeIntervalKey])
+		if err != nil {
+			return ProbeConfig{}, fmt.Errorf("Invalid %s: %s", ProbeIntervalKey, err.Error())
+		}
+		if config.Interval <= 0 {
+			return ProbeConfig{}, fmt.Errorf("Invalid %s: must be greater than 0", ProbeIntervalKey)
+		}
+	}
+	return config, nil
+}
+
+// forEachProbeRef recursively goes through statuses and calls fn for every status referencing the probe id.
+// The full status id is accumulated as we traverse
+func forEachProbeRef(refID string, statuses []*Status, fn func(fullStatusID string, s *Status) error) error {
+	return forEachStatus(statuses, "", func(fullStatusID string, s *Status) error {
+		if s.Probe.RefID != refID {
+			return nil
+		}
+		return fn(fullStatusID, s)
+	})
+}
+
+// forEachStatus recursively calls fn for every status with its full status id
+func forEachStatus(statuses []*Status, statusID string, fn func(fullStatusID string, s *Status) error) error {
+	for _, s := range statuses {
+		fullStatusID := s.ID
+		if statusID != "" {
+			fullStatusID = statusID + IdDelimiter + s.ID
+		}
+		err := fn(fullStatusID, s)
+		if err != nil {
+			return err
+		}
+		err = forEachStatus(s.Children, fullStatusID, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func StartProbes(probes []Probe) {
 	for _, probe := range probes {
 		go probe.Start()
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// ProbeReport is sent by a probe after every poll to report whether the poll itself worked
+type ProbeReport struct {
+	ProbeID string
+	Err     error
+	Time    time.Time
+}
+
+// ProbeHealth is the health of a probe which is shown on the dashboard
+type ProbeHealth struct {
+	ID                  string     `json:"id"`
+	Type                string     `json:"type"`
+	Healthy             bool       `json:"healthy"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastErrorTime       *time.Time `json:"lastErrorTime,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+}
+
+// reportProbeHealth records the metrics of a poll started at start and sends its result to the health channel if the probe has one
+func reportProbeHealth(health chan ProbeReport, probeID string, start time.Time, err error) {
+	observeProbePoll(probeID, start, err)
+	if health == nil {
+		return
+	}
+	health <- ProbeReport{
+		ProbeID: probeID,
+		Err:     err,
+		Time:    time.Now(),
+	}
+}
+
+// newProbeHealths creates the initial health of every defined probe. Probes are healthy until they report otherwise
+func newProbeHealths(probeDefs []ProbeDef) map[string]*ProbeHealth {
+	healths := map[string]*ProbeHealth{}
+	for _, def := range probeDefs {
+		healths[def.ID] = &ProbeHealth{
+			ID:      def.ID,
+			Type:    def.Type,
+			Healthy: true,
+		}
+	}
+	return healths
+}
+
+// apply updates the health with a report and returns whether the change should be shown on the dashboard
+func (ph *ProbeHealth) apply(report ProbeReport) bool {
+	t := report.Time
+	if report.Err == nil {
+		ph.LastSuccess = &t
+		ph.ConsecutiveFailures = 0
+		changed := !ph.Healthy
+		ph.Healthy = true
+		return changed
+	}
+	// errors often include the url or request of the probe which may have a secret
+	lastError := secrets.redact(report.Err.Error())
+	changed := ph.Healthy || ph.LastError != lastError
+	ph.Healthy = false
+	ph.LastError = lastError
+	ph.LastErrorTime = &t
+	ph.ConsecutiveFailures++
+	return changed
+}
+
+// sortedProbeHealths returns copies of the probe healths sorted by id
+func sortedProbeHealths(healths map[string]*ProbeHealth) []ProbeHealth {
+	list := []ProbeHealth{}
+	for _, ph := range healths {
+		list = append(list, *ph)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PrometheusType           = "Prometheus"
+	PrometheusIntervalKey    = "interval"
+	PrometheusURLKey         = "url"
+	PrometheusTimeoutKey     = "timeout"
+	PrometheusBearerTokenKey = "bearerToken"
+	PrometheusQueryKey       = "query"
+	PrometheusGoodKey        = "good"
+	PrometheusDegradedKey    = "degraded"
+	PrometheusBadKey         = "bad"
+	defaultPrometheusTimeout = 10 * time.Second
+	prometheusQueryPath      = "/api/v1/query"
+	maxPrometheusBodySize    = 10 << 20 // queries returning more than 10MB are not meant for a dashboard
+
+	NoPrometheusData = "query returned no data"
+)
+
+var (
+	thresholdCondition = regexp.MustCompile(`^\s*(<=|>=|==|!=|<|>)\s*(\S+)\s*$`)
+)
+
+// PrometheusProbeConfig is the configuration for a prometheus probe
+type PrometheusProbeConfig struct {
+	id          string
+	update      chan StatusUpdate
+	health      chan ProbeReport
+	interval    time.Duration
+	timeout     time.Duration
+	serverURL   string
+	bearerToken string
+}
+
+// PrometheusProbe is a probe that evaluates PromQL expressions with the query api of a Prometheus compatible server
+type PrometheusProbe struct {
+	refID       string
+	update      chan StatusUpdate
+	health      chan ProbeReport
+	interval    time.Duration
+	ticker      *time.Ticker
+	stopChan    chan bool
+	client      *http.Client
+	serverURL   string
+	bearerToken string
+	queries     []*prometheusQuery
+}
+
+// prometheusQuery is the expression of a status along with the thresholds mapping its value to a status
+type prometheusQuery struct {
+	statusID   string
+	query      string
+	thresholds []threshold // checked in order: bad, degraded then good
+}
+
+// threshold is a condition like '>= 0.99' which gives a status when a value matches it
+type threshold struct {
+	status   StatusValue
+	operator string
+	value    float64
+}
+
+// prometheusResponse is the response of the query api
+type prometheusResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// prometheusSample is a timestamp and value like [1435781451.781, "1"]
+type prometheusSample [2]interface{}
+
+func init() {
+	RegisterProbeFactory(ProbeFactory{
+		Type:            PrometheusType,
+		RequiredDefKeys: []string{PrometheusURLKey, PrometheusIntervalKey},
+		RequiredRefKeys: []string{PrometheusQueryKey},
+		New:             newPrometheusProbeFromConfig,
+	})
+}
+
+// newPrometheusProbeFromConfig creates and initializes a prometheus probe for the probe registry
+func newPrometheusProbeFromConfig(config ProbeConfig, statuses []*Status) (Probe, error) {
+	var timeout time.Duration
+	if config.Data[PrometheusTimeoutKey] != "" {
+		var err error
+		timeout, err = time.ParseDuration(config.Data[PrometheusTimeoutKey])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %s", PrometheusTimeoutKey, err.Error())
+		}
+	}
+	pp := NewPrometheusProbe(&PrometheusProbeConfig{
+		id:          config.ID,
+		update:      config.Update,
+		health:      config.Health,
+		interval:    config.Interval,
+		timeout:     timeout,
+		serverURL:   config.Data[PrometheusURLKey],
+		bearerToken: config.Data[PrometheusBearerTokenKey],
+	})
+	err := pp.Initialize(statuses)
+	if err != nil {
+		return nil, err
+	}
+	return pp, nil
+}
+
+// NewPrometheusProbe returns a prometheus probe
+func NewPrometheusProbe(config *PrometheusProbeConfig) *PrometheusProbe {
+	timeout := config.timeout
+	if timeout == 0 {
+		timeout = defaultPrometheusTimeout
+	}
+	return &PrometheusProbe{
+		refID:       config.id,
+		update:      config.update,
+		health:      config.health,
+		interval:    config.interval,
+		stopChan:    make(chan bool),
+		client:      &http.Client{Timeout: timeout},
+		serverURL:   strings.TrimSuffix(config.serverURL, "/"),
+		bearerToken: config.bearerToken,
+		queries:     []*prometheusQuery{},
+	}
+}
+
+// Initialize parses through all status to find which ones have a query
+func (pp *PrometheusProbe) Initialize(statuses []*Status) error {
+	return forEachProbeRef(pp.refID, statuses, func(fullStatusID string, s *Status) error {
+		query, err := newPrometheusQuery(fullStatusID, s)
+		if err != nil {
+			return err
+		}
+		pp.queries = append(pp.queries, query)
+		return nil
+	})
+}
+
+// Start begins evaluating all queries at the given interval
+func (pp *PrometheusProbe) Start() {
+	if pp.ticker == nil {
+		logger.Debug("Starting Prometheus Probe", "refID", pp.refID)
+		pp.ticker = time.NewTicker(pp.interval)
+		pp.probe()
+		for {
+			select {
+			case <-pp.ticker.C:
+				pp.probe()
+			case <-pp.stopChan:
+				pp.ticker.Stop()
+				pp.ticker = nil
+				logger.Debug("Exiting Prometheus Probe", "refID", pp.refID)
+				return
+			}
+		}
+	}
+}
+
+// Stop stops evaluating queries
+func (pp *PrometheusProbe) Stop() {
+	pp.stopChan <- true
+}
+
+// probe evaluates all queries concurrently. A query which cannot be evaluated makes its status unknown
+// and the probe unhealthy
+func (pp *PrometheusProbe) probe() {
+	start := time.Now()
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var probeErr error
+	for _, query := range pp.queries {
+		wg.Add(1)
+		go func(q *prometheusQuery) {
+			defer wg.Done()
+			su := StatusUpdate{ID: q.statusID, Source: pp.refID}
+			values, err := pp.evaluate(q.query)
+			if err != nil {
+				logger.Debug("Prometheus query failed", "refID", pp.refID, "query", q.query, "error", err)
+				lock.Lock()
+				if probeErr == nil {
+					probeErr = err
+				}
+				lock.Unlock()
+				su.Status = StatusUnknown
+				su.Message = err.Error()
+			} else {
+				su.Status, su.Message = q.statusOf(values)
+			}
+			pp.update <- su
+		}(query)
+	}
+	wg.Wait()
+	reportProbeHealth(pp.health, pp.refID, start, probeErr)
+}
+
+// evaluate runs an instant query and returns the value of every series. Scalars are a single value
+func (pp *PrometheusProbe) evaluate(query string) ([]float64, error) {
+	req, err := http.NewRequest(http.MethodGet, pp.serverURL+prometheusQueryPath+"?"+url.Values{"query": {query}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+	if pp.bearerToken != "" {
+		req.Header.Add("Authorization", "Bearer "+pp.bearerToken)
+	}
+	resp, err := pp.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPrometheusBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	// errors like a bad query have a json body with the reason
+	var pr prometheusResponse
+	err = json.Unmarshal(body, &pr)
+	switch {
+	case err == nil && pr.Status == "error":
+		return nil, fmt.Errorf("Prometheus %s error: %s", pr.ErrorType, pr.Error)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("Prometheus responded with status code %d", resp.StatusCode)
+	case err != nil:
+		return nil, fmt.Errorf("Could not parse Prometheus response: %s", err.Error())
+	}
+
+	switch pr.Data.ResultType {
+	case "vector":
+		var series []struct {
+			Value prometheusSample `json:"value"`
+		}
+		err = json.Unmarshal(pr.Data.Result, &series)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse Prometheus vector: %s", err.Error())
+		}
+		values := []float64{}
+		for _, s := range series {
+			value, err := s.Value.value()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case "scalar":
+		var sample prometheusSample
+		err = json.Unmarshal(pr.Data.Result, &sample)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse Prometheus scalar: %s", err.Error())
+		}
+		value, err := sample.value()
+		if err != nil {
+			return nil, err
+		}
+		return []float64{value}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported Prometheus result type '%s'. The query must return a vector or scalar", pr.Data.ResultType)
+	}
+}
+
+// value parses the value which Prometheus sends as a string so NaN and Inf can be represented
+func (ps prometheusSample) value() (float64, error) {
+	s, ok := ps[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("Invalid Prometheus sample value '%v'", ps[1])
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// statusOf returns the worst status of the values along with the values as the message.
+// A value matching no threshold or no values at all is unknown
+func (q *prometheusQuery) statusOf(values []float64) (StatusValue, string) {
+	if len(values) == 0 {
+		return StatusUnknown, NoPrometheusData
+	}
+	status := StatusNone
+	formatted := []string{}
+	for _, v := range values {
+		vs := StatusUnknown
+		for _, t := range q.thresholds {
+			if t.matches(v) {
+				vs = t.status
+				break
+			}
+		}
+		if vs.WorseThan(status) {
+			status = vs
+		}
+		formatted = append(formatted, strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	return status, "value " + strings.Join(formatted, ", ")
+}
+
+func (t threshold) matches(value float64) bool {
+	switch t.operator {
+	case "<":
+		return value < t.value
+	case "<=":
+		return value <= t.value
+	case ">":
+		return value > t.value
+	case ">=":
+		return value >= t.value
+	case "==":
+		return value == t.value
+	case "!=":
+		return value != t.value
+	}
+	return false
+}
+
+func newPrometheusQuery(fullStatusID string, s *Status) (*prometheusQuery, error) {
+	data := s.Probe.Data
+	if data[PrometheusQueryKey] == "" {
+		return nil, fmt.Errorf("%s is missing '%s' field in 'data' for Prometheus probe", s.FullName, PrometheusQueryKey)
+	}
+	query := &prometheusQuery{
+		statusID:   fullStatusID,
+		query:      data[PrometheusQueryKey],
+		thresholds: []threshold{},
+	}
+	for _, key := range []string{PrometheusBadKey, PrometheusDegradedKey, PrometheusGoodKey} {
+		if data[key] == "" {
+			continue
+		}
+		t, err := parseThreshold(StatusValue(key), data[key])
+		if err != nil {
+			return nil, fmt.Errorf("%s has invalid '%s' for Prometheus probe: %s", s.FullName, key, err.Error())
+		}
+		query.thresholds = append(query.thresholds, t)
+	}
+	if len(query.thresholds) == 0 {
+		return nil, fmt.Errorf("%s needs at least one of '%s', '%s' or '%s' in 'data' for Prometheus probe", s.FullName, PrometheusGoodKey, PrometheusDegradedKey, PrometheusBadKey)
+	}
+	return query, nil
+}
+
+// parseThreshold parses a condition like '>= 0.99'
+func parseThreshold(status StatusValue, condition string) (threshold, error) {
+	match := thresholdCondition.FindStringSubmatch(condition)
+	if match == nil {
+		return threshold{}, fmt.Errorf("'%s' must be a comparison like '>= 0.99'", condition)
+	}
+	value, err := strconv.ParseFloat(match[2], 64)
+	if err != nil {
+		return threshold{}, fmt.Errorf("'%s' is not a number", match[2])
+	}
+	return threshold{status: status, operator: match[1], value: value}, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PrometheusProbe", func() {
+	var server *httptest.Server
+	var update chan StatusUpdate
+	var health chan ProbeReport
+
+	BeforeEach(func() {
+		update = make(chan StatusUpdate, 10)
+		health = make(chan ProbeReport, 10)
+		// a fake Prometheus answering a few queries the way the query api does
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != prometheusQueryPath {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer t0ken" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Query().Get("query") {
+			case `avg(up{job="api"})`:
+				w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1435781451.781,"0.97"]}]}}`))
+			case `up{job="web"}`:
+				w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+					`{"metric":{"instance":"a"},"value":[1435781451.781,"1"]},` +
+					`{"metric":{"instance":"b"},"value":[1435781451.781,"0"]}]}}`))
+			case "scalar(42)":
+				w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1435781451.781,"42"]}}`))
+			case `up{job="missing"}`:
+				w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error at char 4"}`))
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newProbe := func(data map[string]string) *PrometheusProbe {
+		pp := NewPrometheusProbe(&PrometheusProbeConfig{
+			id:          "prometheus",
+			update:      update,
+			health:      health,
+			interval:    time.Minute,
+			serverURL:   server.URL + "/",
+			bearerToken: "t0ken",
+		})
+		err := pp.Initialize([]*Status{{
+			ID: "env",
+			Children: []*Status{{
+				ID:    "service",
+				Probe: ProbeRef{RefID: "prometheus", Data: data},
+			}},
+		}})
+		Expect(err).To(BeNil())
+		return pp
+	}
+
+	Describe("Given a status with a query and thresholds", func() {
+		Context("When the value matches a threshold", func() {
+			It("Then the status should be the status of the threshold", func() {
+				newProbe(map[string]string{
+					PrometheusQueryKey:    `avg(up{job="api"})`,
+					PrometheusGoodKey:     ">= 0.99",
+					PrometheusDegradedKey: ">= 0.95",
+					PrometheusBadKey:      "< 0.95",
+				}).probe()
+				Expect(<-update).To(Equal(StatusUpdate{ID: "env#service", Status: StatusDegraded, Source: "prometheus", Message: "value 0.97"}))
+				Expect((<-health).Err).To(BeNil())
+
+				newProbe(map[string]string{PrometheusQueryKey: "scalar(42)", PrometheusGoodKey: "== 42"}).probe()
+				Expect((<-update).Status).To(Equal(StatusGood))
+			})
+		})
+		Context("When the query returns several series", func() {
+			It("Then the status should be the worst of them", func() {
+				newProbe(map[string]string{
+					PrometheusQueryKey: `up{job="web"}`,
+					PrometheusGoodKey:  "== 1",
+					PrometheusBadKey:   "== 0",
+				}).probe()
+				Expect(<-update).To(Equal(StatusUpdate{ID: "env#service", Status: StatusBad, Source: "prometheus", Message: "value 1, 0"}))
+			})
+		})
+		Context("When the value matches no threshold or there is no data", func() {
+			It("Then the status should be unknown", func() {
+				newProbe(map[string]string{PrometheusQueryKey: `avg(up{job="api"})`, PrometheusGoodKey: "> 0.99"}).probe()
+				Expect((<-update).Status).To(Equal(StatusUnknown))
+
+				newProbe(map[string]string{PrometheusQueryKey: `up{job="missing"}`, PrometheusGoodKey: "> 0"}).probe()
+				Expect(<-update).To(Equal(StatusUpdate{ID: "env#service", Status: StatusUnknown, Source: "prometheus", Message: NoPrometheusData}))
+			})
+		})
+		Context("When the query is invalid", func() {
+			It("Then the status should be unknown and the probe unhealthy", func() {
+				newProbe(map[string]string{PrometheusQueryKey: "up{", PrometheusGoodKey: "> 0"}).probe()
+				Expect(<-update).To(Equal(StatusUpdate{ID: "env#service", Status: StatusUnknown, Source: "prometheus", Message: "Prometheus bad_data error: parse error at char 4"}))
+				Expect((<-health).Err).To(MatchError("Prometheus bad_data error: parse error at char 4"))
+			})
+		})
+		Context("When the probe data is invalid", func() {
+			It("Then it should error on initialize", func() {
+				statuses := func(data map[string]string) []*Status {
+					return []*Status{{ID: "service", Probe: ProbeRef{RefID: "prometheus", Data: data}}}
+				}
+				pp := NewPrometheusProbe(&PrometheusProbeConfig{id: "prometheus"})
+				Expect(pp.Initialize(statuses(map[string]string{PrometheusGoodKey: "> 1"}))).ToNot(BeNil())
+				Expect(pp.Initialize(statuses(map[string]string{PrometheusQueryKey: "up"}))).ToNot(BeNil())
+				Expect(pp.Initialize(statuses(map[string]string{PrometheusQueryKey: "up", PrometheusGoodKey: "1"}))).ToNot(BeNil())
+				Expect(pp.Initialize(statuses(map[string]string{PrometheusQueryKey: "up", PrometheusBadKey: "< one"}))).ToNot(BeNil())
+			})
+		})
+	})
+
+	Describe("Given a config with a Prometheus probe", func() {
+		Context("When the probes are created", func() {
+			It("Then the server url and interval should be required", func() {
+				statuses := []*Status{{ID: "api", Probe: ProbeRef{RefID: "prom", Data: map[string]string{PrometheusQueryKey: "up", PrometheusGoodKey: "== 1"}}}}
+				_, err := CreateProbes([]ProbeDef{{ID: "prom", Type: PrometheusType, Data: map[string]string{PrometheusIntervalKey: "1m"}}}, statuses, update, health)
+				Expect(err).To(MatchError(ContainSubstring("url")))
+
+				probes, err := CreateProbes([]ProbeDef{{ID: "prom", Type: PrometheusType, Data: map[string]string{PrometheusIntervalKey: "1m", PrometheusURLKey: server.URL}}}, statuses, update, health)
+				Expect(err).To(BeNil())
+				Expect(probes).To(HaveLen(1))
+			})
+		})
+	})
+})
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	reloadDebounce = 500 * time.Millisecond // editors often write a file several times when saving
+)
+
+// ConfigChanges is what changed in the running monitor after reloading the config
+type ConfigChanges struct {
+	AddedStatuses   []string `json:"addedStatuses"`
+	RemovedStatuses []string `json:"removedStatuses"`
+	StartedProbes   []string `json:"startedProbes"`
+	StoppedProbes   []string `json:"stoppedProbes"`
+	RestartedProbes []string `json:"restartedProbes"`
+}
+
+// Reloader applies changes of the config file to a running monitor. Only the probes whose definition or
+// referencing statuses changed are restarted and statuses with an unchanged id keep their current status
+type Reloader struct {
+	lock    sync.Mutex
+	path    string
+	monitor *Monitor
+	config  Configuration
+	probes  map[string]Probe // key: probe id
+	watcher *fsnotify.Watcher
+	watched map[string]bool // key: cleaned path of the config file and the files it includes
+}
+
+// NewReloader returns a reloader for the monitor running the config along with the probes created from it
+func NewReloader(path string, config Configuration, monitor *Monitor, probes []Probe) *Reloader {
+	r := &Reloader{
+		path:    path,
+		monitor: monitor,
+		config:  config,
+		probes:  map[string]Probe{},
+		watched: map[string]bool{},
+	}
+	// CreateProbes returns the probes in the same order as the definitions
+	for i, def := range config.ProbeDefs {
+		r.probes[def.ID] = probes[i]
+	}
+	monitor.reloader = r
+	return r
+}
+
+// Reload reads the config file and applies it if valid. If it is not, nothing is changed
+func (r *Reloader) Reload() (ConfigChanges, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	config, err := readConfiguration(r.path)
+	if err != nil {
+		return ConfigChanges{}, err
+	}
+	err = validateConfiguration(config)
+	if err != nil {
+		return ConfigChanges{}, err
+	}
+
+	changes := ConfigChanges{}
+	changes.AddedStatuses, changes.RemovedStatuses = diffIDs(fullStatusIDs(r.config.Statuses), fullStatusIDs(config.Statuses))
+	changes.StartedProbes, changes.StoppedProbes, changes.RestartedProbes = diffProbes(r.config, config)
+
+	// create the notifiers and new probes first so one failing to initialize leaves the running ones alone.
+	// The notifiers are created before the probes as probes cannot be stopped before they are started
+	routes, err := newNotifierRoutes(config.Notifiers)
+	if err != nil {
+		return ConfigChanges{}, err
+	}
+	newDefs := []ProbeDef{}
+	for _, def := range config.ProbeDefs {
+		if containsString(changes.StartedProbes, def.ID) || containsString(changes.RestartedProbes, def.ID) {
+			newDefs = append(newDefs, def)
+		}
+	}
+	probes, err := CreateProbes(newDefs, config.Statuses, r.monitor.GetUpdateChan(), r.monitor.GetHealthChan())
+	if err != nil {
+		return ConfigChanges{}, err
+	}
+	r.monitor.notifications.swap(routes)
+
+	// probes are stopped without holding the monitor lock as they may be waiting to send an update
+	for _, id := range append(changes.StoppedProbes, changes.RestartedProbes...) {
+		r.probes[id].Stop()
+		delete(r.probes, id)
+	}
+	err = r.monitor.ReplaceStatuses(config.Statuses, config.ProbeDefs)
+	if err != nil {
+		logger.Error("Could not send new structure", "error", err)
+	}
+	for i, def := range newDefs {
+		r.probes[def.ID] = probes[i]
+	}
+	StartProbes(probes)
+	r.config = config
+	if r.watcher != nil {
+		err = r.watchFiles()
+		if err != nil {
+			logger.Error("Could not watch config files", "error", err)
+		}
+	}
+	return changes, nil
+}
+
+// Watch reloads the config whenever the config file or a file it includes changes. The directories are watched
+// instead of the files so editors that save by replacing the file are noticed
+func (r *Reloader) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.watcher = watcher
+	err = r.watchFiles()
+	if err != nil {
+		watcher.Close()
+		r.watcher = nil
+		return err
+	}
+	go r.watch(watcher)
+	return nil
+}
+
+// watchFiles watches the directories of every file in the current config. Must be called with the lock held
+func (r *Reloader) watchFiles() error {
+	files := r.config.files
+	if len(files) == 0 {
+		files = []string{r.path}
+	}
+	for _, file := range files {
+		file = filepath.Clean(file)
+		if r.watched[file] {
+			continue
+		}
+		err := r.watcher.Add(filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+		r.watched[file] = true
+	}
+	return nil
+}
+
+// isWatched returns whether the file is part of the config
+func (r *Reloader) isWatched(file string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.watched[filepath.Clean(file)]
+}
+
+func (r *Reloader) watch(watcher *fsnotify.Watcher) {
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 || !r.isWatched(event.Name) {
+				continue
+			}
+			debounce = time.After(reloadDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Error("Error watching config file", "error", err)
+		case <-debounce:
+			debounce = nil
+			r.reloadAndLog("config file changed")
+		}
+	}
+}
+
+// ReloadOnSignal reloads the config whenever one of the signals is received
+func (r *Reloader) ReloadOnSignal(signals ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, signals...)
+	go func() {
+		for sig := range c {
+			r.reloadAndLog(sig.String())
+		}
+	}()
+}
+
+func (r *Reloader) reloadAndLog(reason string) {
+	changes, err := r.Reload()
+	if err != nil {
+		logger.Error("Could not reload config, keeping the current config", "reason", reason, "error", err)
+		return
+	}
+	logger.Info("Reloaded config", "reason", reason, "changes", changes)
+}
+
+// Close stops watching the config file and stops all probes
+func (r *Reloader) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for id, probe := range r.probes {
+		probe.Stop()
+		delete(r.probes, id)
+	}
+	if r.watcher != nil {
+		return r.watcher.Close()
+	}
+	return nil
+}
+
+// diffProbes finds the probes to start, stop and restart. A probe is restarted if its definition
+// or any status referencing it changed
+func diffProbes(old, new Configuration) (started, stopped, restarted []string) {
+	oldFingerprints := probeFingerprints(old)
+	newFingerprints := probeFingerprints(new)
+	started, stopped, restarted = []string{}, []string{}, []string{}
+	for id, fingerprint := range newFingerprints {
+		oldFingerprint, ok := oldFingerprints[id]
+		switch {
+		case !ok:
+			started = append(started, id)
+		case oldFingerprint != fingerprint:
+			restarted = append(restarted, id)
+		}
+	}
+	for id := range oldFingerprints {
+		if _, ok := newFingerprints[id]; !ok {
+			stopped = append(stopped, id)
+		}
+	}
+	sort.Strings(started)
+	sort.Strings(stopped)
+	sort.Strings(restarted)
+	return started, stopped, restarted
+}
+
+// probeFingerprints returns everything each probe is created from. Probes with the same fingerprint do not need restarting
+func probeFingerprints(config Configuration) map[string]string {
+	fingerprints := map[string]string{}
+	for _, def := range config.ProbeDefs {
+		refs := map[string]map[string]string{} // key: full status id
+		forEachProbeRef(def.ID, config.Statuses, func(fullStatusID string, s *Status) error {
+			refs[fullStatusID] = s.Probe.Data
+			return nil
+		})
+		// maps are marshalled with sorted keys so the fingerprint is stable
+		fingerprint, _ := json.Marshal(struct {
+			Def  ProbeDef
+			Refs map[string]map[string]string
+		}{def, refs})
+		fingerprints[def.ID] = string(fingerprint)
+	}
+	return fingerprints
+}
+
+// fullStatusIDs returns the full id of every status in the tree
+func fullStatusIDs(statuses []*Status) []string {
+	ids := []string{}
+	forEachStatus(statuses, "", func(fullStatusID string, s *Status) error {
+		ids = append(ids, fullStatusID)
+		return nil
+	})
+	return ids
+}
+
+// diffIDs returns the sorted ids only in new and only in old
+func diffIDs(old, new []string) (added, removed []string) {
+	added, removed = []string{}, []string{}
+	for _, id := range new {
+		if !containsString(old, id) {
+			added = append(added, id)
+		}
+	}
+	for _, id := range old {
+		if !containsString(new, id) {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reloader", func() {
+	var dir, path string
+	var router *mux.Router
+	var server, target *httptest.Server
+	var m *Monitor
+	var reloader *Reloader
+
+	writeConfig := func(config string) {
+		Expect(ioutil.WriteFile(path, []byte(strings.Replace(config, "TARGET", target.URL, -1)), 0600)).To(Succeed())
+	}
+
+	const initialConfig = `{
+		"probes": [
+			{"id": "http1", "type": "HTTP", "data": {"interval": "1h"}},
+			{"id": "http2", "type": "HTTP", "data": {"interval": "1h"}}
+		],
+		"statuses": [{
+			"id": "prod",
+			"rollup": {"mode": "worst"},
+			"children": [
+				{"id": "service1"},
+				{"id": "service2"},
+				{"id": "web1", "probe": {"probeRefId": "http1", "data": {"url": "TARGET"}}},
+				{"id": "web2", "probe": {"probeRefId": "http2", "data": {"url": "TARGET"}}}
+			]
+		}]
+	}`
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "reload")
+		Expect(err).To(BeNil())
+		path = filepath.Join(dir, "config.json")
+		target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		writeConfig(initialConfig)
+
+		config, err := readConfiguration(path)
+		Expect(err).To(BeNil())
+		router = mux.NewRouter()
+		m = NewMonitor(&MonitorConfig{
+			Router:    router,
+			Username:  "admin",
+			Password:  "password",
+			Statuses:  config.Statuses,
+			ProbeDefs: config.ProbeDefs,
+		})
+		probes, err := CreateProbes(config.ProbeDefs, config.Statuses, m.GetUpdateChan(), m.GetHealthChan())
+		Expect(err).To(BeNil())
+		StartProbes(probes)
+		reloader = NewReloader(path, config, m, probes)
+		server = httptest.NewServer(router)
+
+		Expect(m.UpdateStatusByID(StatusUpdate{ID: "prod#service1", Status: StatusBad, Message: "500s"})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		reloader.Close()
+		m.Close()
+		server.Close()
+		target.Close()
+		os.RemoveAll(dir)
+	})
+
+	findStatus := func(id string) StatusValue {
+		m.lock.RLock()
+		defer m.lock.RUnlock()
+		s, err := FindStatus(id, m.statuses)
+		if err != nil {
+			return ""
+		}
+		return s.Status
+	}
+
+	Describe("Given a running monitor", func() {
+		Context("When the config changes and is reloaded", func() {
+			It("Then only the affected statuses and probes should change", func() {
+				writeConfig(`{
+					"probes": [
+						{"id": "http1", "type": "HTTP", "data": {"interval": "1h"}},
+						{"id": "http2", "type": "HTTP", "data": {"interval": "1h", "timeout": "5s"}},
+						{"id": "http3", "type": "HTTP", "data": {"interval": "1h"}}
+					],
+					"statuses": [{
+						"id": "prod",
+						"rollup": {"mode": "worst"},
+						"children": [
+							{"id": "service1"},
+							{"id": "service3", "status": "good"},
+							{"id": "web1", "probe": {"probeRefId": "http1", "data": {"url": "TARGET"}}},
+							{"id": "web2", "probe": {"probeRefId": "http2", "data": {"url": "TARGET"}}},
+							{"id": "web3", "probe": {"probeRefId": "http3", "data": {"url": "TARGET"}}}
+						]
+					}]
+				}`)
+				changes, err := reloader.Reload()
+				Expect(err).To(BeNil())
+				Expect(changes).To(Equal(ConfigChanges{
+					AddedStatuses:   []string{"prod#service3", "prod#web3"},
+					RemovedStatuses: []string{"prod#service2"},
+					StartedProbes:   []string{"http3"},
+					StoppedProbes:   []string{},
+					RestartedProbes: []string{"http2"},
+				}))
+				Expect(findStatus("prod#service1")).To(Equal(StatusBad))
+				Expect(findStatus("prod#service3")).To(Equal(StatusGood))
+				Expect(findStatus("prod")).To(Equal(StatusBad))
+				Eventually(func() StatusValue { return findStatus("prod#web3") }).Should(Equal(StatusGood))
+				Expect(m.ProbeHealths()).To(HaveLen(3))
+			})
+		})
+		Context("When probes are removed", func() {
+			It("Then they should be stopped", func() {
+				writeConfig(`{"statuses": [{"id": "prod", "children": [{"id": "service1"}]}]}`)
+				changes, err := reloader.Reload()
+				Expect(err).To(BeNil())
+				Expect(changes.StoppedProbes).To(Equal([]string{"http1", "http2"}))
+				Expect(reloader.probes).To(BeEmpty())
+				Expect(m.ProbeHealths()).To(BeEmpty())
+			})
+		})
+		Context("When the new config is invalid", func() {
+			It("Then the running config should be kept", func() {
+				writeConfig(`{"statuses": [{"id": "prod", "children": [{"id": "web1", "probe": {"probeRefId": "missing"}}]}]}`)
+				_, err := reloader.Reload()
+				Expect(err).To(BeAssignableToTypeOf(ConfigError{}))
+				Expect(findStatus("prod#service2")).To(Equal(StatusNone))
+				_, err = FindStatus("prod#service2", m.statuses)
+				Expect(err).To(BeNil())
+				Expect(reloader.probes).To(HaveLen(2))
+			})
+		})
+		Context("When a websocket client is connected", func() {
+			It("Then it should be sent the new structure", func() {
+				url := "ws://" + strings.TrimPrefix(server.URL, "http://") + "/live"
+				header := http.Header{}
+				header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:password")))
+				conn, _, err := websocket.DefaultDialer.Dial(url, header)
+				Expect(err).To(BeNil())
+				defer conn.Close()
+
+				writeConfig(`{"statuses": [{"id": "prod", "children": [{"id": "service1"}]}]}`)
+				_, err = reloader.Reload()
+				Expect(err).To(BeNil())
+
+				Eventually(func() string {
+					var message SnapshotMessage
+					_, payload, err := conn.ReadMessage()
+					if err != nil {
+						return err.Error()
+					}
+					json.Unmarshal(payload, &message)
+					if message.Type != structureMessageType {
+						return message.Type
+					}
+					Expect(message.Statuses[0].Children).To(HaveLen(1))
+					Expect(message.Statuses[0].Children[0].Status).To(Equal(StatusBad))
+					return message.Type
+				}).Should(Equal(structureMessageType))
+			})
+		})
+		Context("When the config file is written while watched", func() {
+			It("Then it should be reloaded", func() {
+				Expect(reloader.Watch()).To(Succeed())
+				writeConfig(`{"statuses": [{"id": "prod", "children": [{"id": "service1"}]}]}`)
+				Eventually(func() StatusValue { return findStatus("prod#web1") }, 5*time.Second).Should(Equal(StatusNone))
+				Expect(findStatus("prod#service1")).To(Equal(StatusBad))
+			})
+		})
+		Context("When reloaded through the api", func() {
+			It("Then the changes should be returned", func() {
+				writeConfig(`{"statuses": [{"id": "prod", "children": [{"id": "service1"}]}]}`)
+				r := httptest.NewRequest(http.MethodPost, "/api/v1/reload", nil)
+				r.SetBasicAuth("admin", "password")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				var changes ConfigChanges
+				Expect(json.Unmarshal(w.Body.Bytes(), &changes)).To(Succeed())
+				Expect(changes.RemovedStatuses).To(Equal([]string{"prod#service2", "prod#web1", "prod#web2"}))
+			})
+		})
+	})
+})
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RollupMode is how the status of a parent is computed from its children
+type RollupMode string
+
+const (
+	RollupWorst      RollupMode = "worst"      // the most severe status of the children
+	RollupBest       RollupMode = "best"       // the least severe status of the children
+	RollupPercentage RollupMode = "percentage" // degraded or bad once a percentage of the children are bad
+	RollupQuorum     RollupMode = "quorum"     // good as long as a number of children are good
+)
+
+var rollupModes = []RollupMode{RollupWorst, RollupBest, RollupPercentage, RollupQuorum}
+
+// Rollup defines how the status of a parent is computed from its children.
+// Children without a status yet are ignored and unknown children are never counted as good or bad
+type Rollup struct {
+	Mode            RollupMode `json:"mode"`
+	DegradedPercent float64    `json:"degradedPercent,omitempty"` // percentage: degraded if more than this percent of the children are bad. 0 disables
+	BadPercent      float64    `json:"badPercent,omitempty"`      // percentage: bad if more than this percent of the children are bad. 0 disables
+	Quorum          int        `json:"quorum,omitempty"`          // quorum: good if at least this many children are good, degraded if at least this many are good or degraded
+}
+
+// UnmarshalJSON only accepts the known roll-up modes
+func (rm *RollupMode) UnmarshalJSON(b []byte) error {
+	var value string
+	err := json.Unmarshal(b, &value)
+	if err != nil {
+		return err
+	}
+	for _, mode := range rollupModes {
+		if string(mode) == value {
+			*rm = mode
+			return nil
+		}
+	}
+	modes := []string{}
+	for _, mode := range rollupModes {
+		modes = append(modes, string(mode))
+	}
+	return fmt.Errorf("Invalid roll-up mode '%s'. Must be one of: %s", value, strings.Join(modes, ", "))
+}
+
+// Compute returns the status of a parent with the given children
+func (r *Rollup) Compute(children []*Status) StatusValue {
+	values := []StatusValue{}
+	for _, child := range children {
+		if child.Status != StatusNone {
+			values = append(values, child.Status)
+		}
+	}
+	if len(values) == 0 {
+		return StatusNone
+	}
+
+	switch r.Mode {
+	case RollupBest:
+		best := values[0]
+		for _, v := range values {
+			if best.WorseThan(v) {
+				best = v
+			}
+		}
+		return best
+	case RollupPercentage:
+		percentBad := 100 * float64(countStatuses(values, StatusBad)) / float64(len(values))
+		switch {
+		case r.BadPercent > 0 && percentBad > r.BadPercent:
+			return StatusBad
+		case r.DegradedPercent > 0 && percentBad > r.DegradedPercent:
+			return StatusDegraded
+		default:
+			return StatusGood
+		}
+	case RollupQuorum:
+		good := countStatuses(values, StatusGood)
+		switch {
+		case good >= r.Quorum:
+			return StatusGood
+		case good+countStatuses(values, StatusDegraded) >= r.Quorum:
+			return StatusDegraded
+		default:
+			return StatusBad
+		}
+	default:
+		worst := values[0]
+		for _, v := range values {
+			if v.WorseThan(worst) {
+				worst = v
+			}
+		}
+		return worst
+	}
+}
+
+func countStatuses(values []StatusValue, status StatusValue) int {
+	count := 0
+	for _, v := range values {
+		if v == status {
+			count++
+		}
+	}
+	return count
+}
+
+// computeRollups computes the status of every parent with a roll-up from the bottom up
+func computeRollups(statuses []*Status) {
+	for _, s := range statuses {
+		computeRollups(s.Children)
+		if s.Rollup != nil {
+			s.Status = s.Rollup.Compute(s.Children)
+		}
+	}
+}
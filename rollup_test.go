@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rollup", func() {
+	children := func(values ...StatusValue) []*Status {
+		statuses := []*Status{}
+		for _, v := range values {
+			statuses = append(statuses, &Status{Status: v})
+		}
+		return statuses
+	}
+
+	Describe("Given children with statuses", func() {
+		Context("When rolled up by worst", func() {
+			It("Then the most severe status should be used", func() {
+				r := &Rollup{Mode: RollupWorst}
+				Expect(r.Compute(children(StatusGood, StatusUnknown, StatusGood))).To(Equal(StatusUnknown))
+				Expect(r.Compute(children(StatusGood, StatusBad, StatusDegraded))).To(Equal(StatusBad))
+			})
+		})
+		Context("When rolled up by best", func() {
+			It("Then the least severe status should be used", func() {
+				r := &Rollup{Mode: RollupBest}
+				Expect(r.Compute(children(StatusBad, StatusDegraded))).To(Equal(StatusDegraded))
+			})
+		})
+		Context("When rolled up by percentage", func() {
+			It("Then the percentage of bad children should be compared to the thresholds", func() {
+				r := &Rollup{Mode: RollupPercentage, DegradedPercent: 10, BadPercent: 50}
+				Expect(r.Compute(children(StatusGood, StatusGood, StatusGood, StatusGood))).To(Equal(StatusGood))
+				Expect(r.Compute(children(StatusBad, StatusGood, StatusGood, StatusGood))).To(Equal(StatusDegraded))
+				Expect(r.Compute(children(StatusBad, StatusBad, StatusBad, StatusGood))).To(Equal(StatusBad))
+			})
+		})
+		Context("When rolled up by quorum", func() {
+			It("Then the number of good children should be compared to the quorum", func() {
+				r := &Rollup{Mode: RollupQuorum, Quorum: 2}
+				Expect(r.Compute(children(StatusGood, StatusGood, StatusBad))).To(Equal(StatusGood))
+				Expect(r.Compute(children(StatusGood, StatusDegraded, StatusBad))).To(Equal(StatusDegraded))
+				Expect(r.Compute(children(StatusGood, StatusBad, StatusBad))).To(Equal(StatusBad))
+			})
+		})
+		Context("When no child has a status yet", func() {
+			It("Then the parent should not have a status", func() {
+				r := &Rollup{Mode: RollupWorst}
+				Expect(r.Compute(children(StatusNone, StatusNone))).To(Equal(StatusNone))
+			})
+		})
+	})
+
+	Describe("Given roll-up json", func() {
+		Context("When the mode is unknown", func() {
+			It("Then it should error", func() {
+				var s Status
+				Expect(json.Unmarshal([]byte(`{"rollup": {"mode": "quorum", "quorum": 2}}`), &s)).To(Succeed())
+				Expect(s.Rollup.Quorum).To(Equal(2))
+				Expect(json.Unmarshal([]byte(`{"rollup": {"mode": "average"}}`), &s)).ToNot(Succeed())
+			})
+		})
+	})
+
+	Describe("Given a Monitor with roll-up parents", func() {
+		var service1, service2, prod, env *Status
+		var m *Monitor
+		BeforeEach(func() {
+			service1 = &Status{ID: "service1", Status: StatusGood}
+			service2 = &Status{ID: "service2", Status: StatusGood}
+			prod = &Status{ID: "prod", Rollup: &Rollup{Mode: RollupWorst}, Children: []*Status{service1, service2}}
+			env = &Status{ID: "env", Rollup: &Rollup{Mode: RollupBest}, Children: []*Status{
+				prod,
+				{ID: "dev", Status: StatusDegraded},
+			}}
+			m = NewMonitor(&MonitorConfig{
+				Router:   mux.NewRouter(),
+				Statuses: []*Status{env},
+			})
+		})
+		Context("When the Monitor is created", func() {
+			It("Then the parents should be computed", func() {
+				Expect(prod.Status).To(Equal(StatusGood))
+				Expect(env.Status).To(Equal(StatusGood))
+			})
+		})
+		Context("When a child changes", func() {
+			It("Then every parent above it should be recomputed", func() {
+				err := m.UpdateStatusByID(StatusUpdate{ID: "env#prod#service2", Status: StatusBad})
+				Expect(err).To(BeNil())
+				Expect(prod.Status).To(Equal(StatusBad))
+				Expect(env.Status).To(Equal(StatusDegraded))
+			})
+		})
+	})
+})
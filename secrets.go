@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	logging "github.com/op/go-logging"
+)
+
+const (
+	secretFilePrefix = "file:"
+	secretEnvPrefix  = "secret:"
+	redactedSecret   = "******"
+	minSecretLength  = 4 // shorter values are too likely to be part of other values to be hidden
+)
+
+var (
+	configVariable  = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+	envVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// secrets has every value read from a secret file or secret environment variable by any config loaded
+	secrets = &secretValues{values: map[string]bool{}, fields: map[string]bool{}}
+)
+
+// secretValues are hidden from the dashboard and the logs
+type secretValues struct {
+	lock   sync.RWMutex
+	values map[string]bool
+	sorted []string        // longest first so a secret containing another is hidden whole
+	fields map[string]bool // config values which had a secret interpolated
+}
+
+func (sv *secretValues) add(value string) {
+	if len(value) < minSecretLength {
+		return
+	}
+	sv.lock.Lock()
+	defer sv.lock.Unlock()
+	if sv.values[value] {
+		return
+	}
+	sv.values[value] = true
+	sv.sorted = append(sv.sorted, value)
+	sort.SliceStable(sv.sorted, func(i, j int) bool {
+		return len(sv.sorted[i]) > len(sv.sorted[j])
+	})
+}
+
+// addField records a config value which had a secret interpolated
+func (sv *secretValues) addField(value string) {
+	sv.lock.Lock()
+	defer sv.lock.Unlock()
+	sv.fields[value] = true
+}
+
+// redactField replaces every secret in s if it is a config value which had a secret interpolated.
+// Other config values are shown as they are so names happening to contain a secret are not mangled
+func (sv *secretValues) redactField(s string) string {
+	sv.lock.RLock()
+	interpolated := sv.fields[s]
+	sv.lock.RUnlock()
+	if !interpolated {
+		return s
+	}
+	return sv.redact(s)
+}
+
+// redact replaces every secret in s
+func (sv *secretValues) redact(s string) string {
+	sv.lock.RLock()
+	defer sv.lock.RUnlock()
+	for _, value := range sv.sorted {
+		s = strings.Replace(s, value, redactedSecret, -1)
+	}
+	return s
+}
+
+// interpolateVariables replaces ${NAME} and ${secret:NAME} in every string with the environment variable and ${file:path}
+// with the content of the file. Relative paths are from dir. $${ is left as ${. Every secret file read is added to files.
+// Only the values of files and secret environment variables are secrets
+func interpolateVariables(value interface{}, path string, dir string, files *[]string) (interface{}, []ConfigProblem) {
+	switch v := value.(type) {
+	case string:
+		problems := []ConfigProblem{}
+		hasSecret := false
+		interpolated := configVariable.ReplaceAllStringFunc(v, func(match string) string {
+			if strings.HasPrefix(match, "$$") {
+				return match[1:]
+			}
+			value, secret, err := resolveVariable(configVariable.FindStringSubmatch(match)[1], dir, files)
+			if err != nil {
+				problems = append(problems, ConfigProblem{path, err.Error()})
+				return ""
+			}
+			if secret {
+				secrets.add(value)
+				hasSecret = true
+			}
+			return value
+		})
+		if hasSecret {
+			secrets.addField(interpolated)
+		}
+		return interpolated, problems
+	case map[string]interface{}:
+		problems := []ConfigProblem{}
+		m := map[string]interface{}{}
+		keys := []string{}
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			interpolated, childProblems := interpolateVariables(v[key], childPath, dir, files)
+			m[key] = interpolated
+			problems = append(problems, childProblems...)
+		}
+		return m, problems
+	case []interface{}:
+		problems := []ConfigProblem{}
+		list := []interface{}{}
+		for i, child := range v {
+			interpolated, childProblems := interpolateVariables(child, fmt.Sprintf("%s[%d]", path, i), dir, files)
+			list = append(list, interpolated)
+			problems = append(problems, childProblems...)
+		}
+		return list, problems
+	default:
+		return v, nil
+	}
+}
+
+// resolveVariable returns the value of the variable and whether it is a secret
+func resolveVariable(name string, dir string, files *[]string) (string, bool, error) {
+	if strings.HasPrefix(name, secretFilePrefix) {
+		file := strings.TrimPrefix(name, secretFilePrefix)
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("could not read secret file: %s", err.Error())
+		}
+		*files = append(*files, file)
+		// files usually end with a new line which is not part of the secret
+		return strings.TrimRight(string(content), "\r\n"), true, nil
+	}
+	secret := strings.HasPrefix(name, secretEnvPrefix)
+	envName := strings.TrimPrefix(name, secretEnvPrefix)
+	if !envVariableName.MatchString(envName) {
+		return "", false, fmt.Errorf("invalid variable '${%s}'. Must be ${ENV_VAR}, ${secret:ENV_VAR} or ${file:path}", name)
+	}
+	value, ok := os.LookupEnv(envName)
+	if !ok {
+		return "", false, fmt.Errorf("undefined environment variable '%s'", envName)
+	}
+	return value, secret, nil
+}
+
+// redactingBackend hides secrets in the arguments of every log record before it is written
+type redactingBackend struct {
+	backend logging.Backend
+}
+
+func (rb redactingBackend) Log(level logging.Level, calldepth int, record *logging.Record) error {
+	for i, arg := range record.Args {
+		s := fmt.Sprint(arg)
+		if redacted := secrets.redact(s); redacted != s {
+			record.Args[i] = redacted
+		}
+	}
+	return rb.backend.Log(level, calldepth+1, record)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/mux"
+	logging "github.com/op/go-logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config variables and secrets", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "secrets")
+		Expect(err).To(BeNil())
+		os.Setenv("MONITOR_TEST_TEAM", "Payments")
+		os.Setenv("MONITOR_TEST_API_KEY", "k3y-from-env")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+		os.Unsetenv("MONITOR_TEST_TEAM")
+		os.Unsetenv("MONITOR_TEST_API_KEY")
+	})
+
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		return path
+	}
+
+	Describe("Given a config using environment variables and secret files", func() {
+		var path string
+
+		BeforeEach(func() {
+			writeFile("newrelic.key", "s3cret-from-file\n")
+			path = writeFile("config.json", `{
+				"dashboardName": "${MONITOR_TEST_TEAM} dashboard",
+				"probes": [{"id": "nr", "type": "NewRelic", "data": {"apiKey": "${file:newrelic.key}", "interval": "1m"}}],
+				"statuses": [{
+					"id": "api",
+					"url": "https://example.com/?key=${secret:MONITOR_TEST_API_KEY}",
+					"subText": "costs $${PRICE}",
+					"probe": {"probeRefId": "nr", "data": {"monitorName": "api"}}
+				}, {
+					"id": "team",
+					"fullName": "${MONITOR_TEST_TEAM}",
+					"subText": "Payments API"
+				}]
+			}`)
+		})
+
+		Context("When it is read", func() {
+			It("Then the variables should be replaced", func() {
+				config, err := readConfiguration(path)
+				Expect(err).To(BeNil())
+				Expect(config.Name).To(Equal("Payments dashboard"))
+				Expect(config.ProbeDefs[0].Data["apiKey"]).To(Equal("s3cret-from-file"))
+				Expect(config.Statuses[0].URL).To(Equal("https://example.com/?key=k3y-from-env"))
+				Expect(config.Statuses[0].SubText).To(Equal("costs ${PRICE}"))
+				Expect(config.files).To(Equal([]string{path, filepath.Join(dir, "newrelic.key")}))
+			})
+		})
+
+		Context("When the statuses are requested", func() {
+			It("Then the secrets should be redacted", func() {
+				config, err := readConfiguration(path)
+				Expect(err).To(BeNil())
+				config.Statuses[0].Probe.Data["apiKey"] = config.ProbeDefs[0].Data["apiKey"]
+				m := NewMonitor(&MonitorConfig{Router: mux.NewRouter(), Statuses: config.Statuses, ProbeDefs: config.ProbeDefs})
+				w := httptest.NewRecorder()
+				m.getStatusHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).NotTo(ContainSubstring("k3y-from-env"))
+				Expect(w.Body.String()).NotTo(ContainSubstring("s3cret-from-file"))
+				Expect(w.Body.String()).To(ContainSubstring(`"url":"https://example.com/?key=******"`))
+				Expect(w.Body.String()).To(ContainSubstring(`"apiKey":"******"`))
+				Expect(config.Statuses[0].URL).To(Equal("https://example.com/?key=k3y-from-env"))
+			})
+		})
+
+		Context("When the statuses with values that are not secret are requested", func() {
+			It("Then the values should be shown unchanged", func() {
+				config, err := readConfiguration(path)
+				Expect(err).To(BeNil())
+				m := NewMonitor(&MonitorConfig{Router: mux.NewRouter(), Statuses: config.Statuses, ProbeDefs: config.ProbeDefs})
+				w := httptest.NewRecorder()
+				m.getStatusHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring(`"fullName":"Payments"`))
+				Expect(w.Body.String()).To(ContainSubstring(`"subText":"Payments API"`))
+			})
+		})
+
+		Context("When a probe fails with an error containing a secret", func() {
+			It("Then the error shown should be redacted", func() {
+				_, err := readConfiguration(path)
+				Expect(err).To(BeNil())
+				ph := &ProbeHealth{ID: "nr", Healthy: true}
+				ph.apply(ProbeReport{ProbeID: "nr", Err: errors.New("GET https://example.com/?key=k3y-from-env: timeout"), Time: time.Now()})
+				Expect(ph.LastError).To(Equal("GET https://example.com/?key=******: timeout"))
+			})
+		})
+
+		Context("When a secret is logged", func() {
+			It("Then the secret should be redacted", func() {
+				_, err := readConfiguration(path)
+				Expect(err).To(BeNil())
+				// the backend is used directly as other goroutines may be logging through the global one
+				memory := logging.NewMemoryBackend(1)
+				record := &logging.Record{Level: logging.INFO, Args: []interface{}{"Polling", "url", "https://example.com/?key=k3y-from-env", "attempt", 2}}
+				Expect(redactingBackend{memory}.Log(logging.INFO, 0, record)).To(Succeed())
+				Expect(memory.Head().Record.Message()).To(Equal("Polling url https://example.com/?key=****** attempt 2"))
+			})
+		})
+	})
+
+	Describe("Given a config with variables that cannot be resolved", func() {
+		var path string
+
+		BeforeEach(func() {
+			path = writeFile("config.json", `{
+				"dashboardName": "${MONITOR_TEST_UNDEFINED}",
+				"statuses": [{"id": "api", "probe": {"data": {"token": "${file:missing.key}", "user": "${not a variable}"}}}]
+			}`)
+		})
+
+		Context("When it is validated", func() {
+			It("Then every variable should be reported with its path", func() {
+				problems, err := validateConfigFile(path)
+				Expect(err).To(BeNil())
+				Expect(problems).To(HaveLen(3))
+				Expect(problems[0]).To(Equal(ConfigProblem{"dashboardName", "undefined environment variable 'MONITOR_TEST_UNDEFINED'"}))
+				Expect(problems[1].Path).To(Equal("statuses[0].probe.data.token"))
+				Expect(problems[1].Message).To(ContainSubstring("could not read secret file"))
+				Expect(problems[2]).To(Equal(ConfigProblem{"statuses[0].probe.data.user", "invalid variable '${not a variable}'. Must be ${ENV_VAR}, ${secret:ENV_VAR} or ${file:path}"}))
+			})
+		})
+
+		Context("When it is read", func() {
+			It("Then an error should be returned", func() {
+				_, err := readConfiguration(path)
+				Expect(err).To(MatchError(ContainSubstring("dashboardName: undefined environment variable 'MONITOR_TEST_UNDEFINED'")))
+			})
+		})
+	})
+
+	Describe("Given a config with a variable that cannot be resolved and other problems", func() {
+		var path string
+
+		BeforeEach(func() {
+			writeFile("team.json", `{"statuses": [{"id": "web", "url": "${MONITOR_TEST_UNDEFINED}"}]}`)
+			path = writeFile("config.json", `{
+				"dashboardName": "${MONITOR_TEST_UNDEFINED}",
+				"statuses": [{"id": "api", "probe": {"probeRefId": "missing"}}, {"include": "team.json"}, {"id": "api"}]
+			}`)
+		})
+
+		Context("When it is validated", func() {
+			It("Then every problem should be reported together", func() {
+				problems, err := validateConfigFile(path)
+				Expect(err).To(BeNil())
+				Expect(problems).To(Equal([]ConfigProblem{
+					{"dashboardName", "undefined environment variable 'MONITOR_TEST_UNDEFINED'"},
+					{filepath.Join(dir, "team.json") + ": statuses[0].url", "undefined environment variable 'MONITOR_TEST_UNDEFINED'"},
+					{"statuses[0].probe.probeRefId", "undefined probe 'missing'"},
+					{"statuses[2].id", "duplicate id 'api'"},
+				}))
+			})
+		})
+	})
+})
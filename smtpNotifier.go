@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	SMTPType           = "SMTP"
+	SMTPAddressKey     = "address"
+	SMTPFromKey        = "from"
+	SMTPToKey          = "to"
+	SMTPUsernameKey    = "username"
+	SMTPPasswordKey    = "password"
+	SMTPSubjectKey     = "subject"
+	defaultSMTPSubject = "[{{.Status}}] {{.FullName}}"
+)
+
+// SMTPNotifier emails the message of notifications. STARTTLS is used if the server supports it
+type SMTPNotifier struct {
+	address string // host:port of the server
+	from    string
+	to      []string
+	auth    smtp.Auth // nil if no username is given
+	subject *template.Template
+}
+
+func init() {
+	RegisterNotifierFactory(NotifierFactory{
+		Type:         SMTPType,
+		RequiredKeys: []string{SMTPAddressKey, SMTPFromKey, SMTPToKey},
+		New: func(def NotifierDef) (Notifier, error) {
+			return NewSMTPNotifier(def.Data)
+		},
+	})
+}
+
+// NewSMTPNotifier returns an smtp notifier from the data of the notifier definition
+func NewSMTPNotifier(data map[string]string) (*SMTPNotifier, error) {
+	host, _, err := net.SplitHostPort(data[SMTPAddressKey])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %s", SMTPAddressKey, err.Error())
+	}
+	to := []string{}
+	for _, address := range strings.Split(data[SMTPToKey], ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			to = append(to, address)
+		}
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf("Invalid %s: no addresses", SMTPToKey)
+	}
+	subject := data[SMTPSubjectKey]
+	if subject == "" {
+		subject = defaultSMTPSubject
+	}
+	subjectTemplate, err := parseNotificationTemplate(SMTPSubjectKey, subject)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %s", SMTPSubjectKey, err.Error())
+	}
+	sn := &SMTPNotifier{
+		address: data[SMTPAddressKey],
+		from:    data[SMTPFromKey],
+		to:      to,
+		subject: subjectTemplate,
+	}
+	if data[SMTPUsernameKey] != "" {
+		sn.auth = smtp.PlainAuth("", data[SMTPUsernameKey], data[SMTPPasswordKey], host)
+	}
+	return sn, nil
+}
+
+// Notify emails the message of the notification to every recipient
+func (sn *SMTPNotifier) Notify(n Notification) error {
+	var subject bytes.Buffer
+	err := sn.subject.Execute(&subject, n)
+	if err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", sn.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(sn.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", secrets.redact(subject.String())))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Timestamp.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n", n.Text)
+	return sn.send(msg.Bytes())
+}
+
+// send is smtp.SendMail with a deadline so a server that stops responding does not hold up the notifications
+func (sn *SMTPNotifier) send(msg []byte) error {
+	conn, err := net.DialTimeout("tcp", sn.address, notifierTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(notifierTimeout))
+	host, _, _ := net.SplitHostPort(sn.address)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+	if sn.auth != nil {
+		err = c.Auth(sn.auth)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.Mail(sn.from)
+	if err != nil {
+		return err
+	}
+	for _, to := range sn.to {
+		err = c.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// smtpMail is a mail received by the stand-in smtp server
+type smtpMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// serveSMTP accepts one connection and answers just enough of the smtp protocol to receive a mail.
+// The address of the server is returned
+func serveSMTP(mails chan smtpMail) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(BeNil())
+	go func() {
+		defer GinkgoRecover()
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) {
+			fmt.Fprintf(conn, "%s\r\n", line)
+		}
+		mail := smtpMail{}
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch command {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "MAIL":
+				mail.from = strings.TrimPrefix(line, "MAIL FROM:")
+				reply("250 OK")
+			case "RCPT":
+				mail.to = append(mail.to, strings.TrimPrefix(line, "RCPT TO:"))
+				reply("250 OK")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				mail.data = data.String()
+				mails <- mail
+				reply("250 OK")
+			case "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return l.Addr().String()
+}
+
+var _ = Describe("SMTPNotifier", func() {
+	var mails chan smtpMail
+
+	BeforeEach(func() {
+		mails = make(chan smtpMail, 1)
+	})
+
+	Describe("Given an SMTP notifier", func() {
+		Context("When a notification is sent", func() {
+			It("Then every recipient should be emailed the message", func() {
+				sn, err := NewSMTPNotifier(map[string]string{
+					SMTPAddressKey: serveSMTP(mails),
+					SMTPFromKey:    "monitor@example.com",
+					SMTPToKey:      "ops@example.com, web@example.com",
+				})
+				Expect(err).To(BeNil())
+				Expect(sn.Notify(Notification{
+					ID:        "prod#web",
+					FullName:  "Production / Website",
+					Status:    StatusBad,
+					Previous:  StatusGood,
+					Timestamp: time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC),
+					Text:      "Production / Website is bad (was good)",
+				})).To(Succeed())
+
+				mail := <-mails
+				Expect(mail.from).To(Equal("<monitor@example.com>"))
+				Expect(mail.to).To(Equal([]string{"<ops@example.com>", "<web@example.com>"}))
+				Expect(mail.data).To(Equal("From: monitor@example.com\r\n" +
+					"To: ops@example.com, web@example.com\r\n" +
+					"Subject: [bad] Production / Website\r\n" +
+					"Date: Thu, 01 Mar 2018 12:00:00 +0000\r\n" +
+					"Content-Type: text/plain; charset=utf-8\r\n" +
+					"\r\n" +
+					"Production / Website is bad (was good)\r\n"))
+			})
+		})
+		Context("When the server cannot be reached", func() {
+			It("Then it should error", func() {
+				l, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).To(BeNil())
+				address := l.Addr().String()
+				l.Close()
+				sn, err := NewSMTPNotifier(map[string]string{SMTPAddressKey: address, SMTPFromKey: "monitor@example.com", SMTPToKey: "ops@example.com"})
+				Expect(err).To(BeNil())
+				Expect(sn.Notify(Notification{})).ToNot(Succeed())
+			})
+		})
+		Context("When the data is invalid", func() {
+			It("Then it should error on create", func() {
+				_, err := NewSMTPNotifier(map[string]string{SMTPAddressKey: "localhost", SMTPFromKey: "monitor@example.com", SMTPToKey: "ops@example.com"})
+				Expect(err).ToNot(BeNil())
+				_, err = NewSMTPNotifier(map[string]string{SMTPAddressKey: "localhost:25", SMTPFromKey: "monitor@example.com", SMTPToKey: " , "})
+				Expect(err).ToNot(BeNil())
+				_, err = NewSMTPNotifier(map[string]string{SMTPAddressKey: "localhost:25", SMTPFromKey: "monitor@example.com", SMTPToKey: "ops@example.com", SMTPSubjectKey: "{{.Subject}}"})
+				Expect(err).ToNot(BeNil())
+			})
+		})
+	})
+})
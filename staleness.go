@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	staleSweepInterval  = 10 * time.Second
+	defaultTTLIntervals = 3 // statuses of a probe with an interval are stale after this many intervals without an update
+)
+
+// probeIntervals returns the polling interval of each probe which has one
+func probeIntervals(probeDefs []ProbeDef) map[string]time.Duration {
+	intervals := map[string]time.Duration{}
+	for _, def := range probeDefs {
+		interval, err := time.ParseDuration(def.Data[ProbeIntervalKey])
+		if err == nil && interval > 0 {
+			intervals[def.ID] = interval
+		}
+	}
+	return intervals
+}
+
+// statusTTLs finds the statuses which are marked stale if not updated in time along with how long they can go without an update
+func statusTTLs(statuses []*Status, intervals map[string]time.Duration) map[string]time.Duration {
+	ttls := map[string]time.Duration{}
+	forEachStatus(statuses, "", func(fullStatusID string, s *Status) error {
+		ttl, err := statusTTL(s, intervals[s.Probe.RefID])
+		if err != nil {
+			logger.Error("Invalid ttl, status will not be marked stale", "id", fullStatusID, "ttl", s.TTL)
+			return nil
+		}
+		if ttl > 0 {
+			ttls[fullStatusID] = ttl
+		}
+		return nil
+	})
+	return ttls
+}
+
+// statusTTL returns how long the status can go without an update, given the interval of its probe, or 0 if it never goes stale.
+// The ttl defaults to a few intervals of its probe and a ttl of 0 or a roll-up never goes stale
+func statusTTL(s *Status, interval time.Duration) (time.Duration, error) {
+	if s.Rollup != nil {
+		return 0, nil
+	}
+	if s.TTL == "" {
+		return defaultTTLIntervals * interval, nil
+	}
+	ttl, err := time.ParseDuration(s.TTL)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid ttl '%s'", s.TTL)
+	}
+	return ttl, nil
+}
+
+// staleSweeper periodically marks the statuses which stopped being updated as stale until the monitor is closed
+func (m *Monitor) staleSweeper() {
+	ticker := time.NewTicker(staleSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.sweepStale(time.Now())
+		case <-m.closed:
+			return
+		}
+	}
+}
+
+// sweepStale marks every status not updated within its ttl by now as stale and unknown so the last status does not sit
+// on the dashboard forever when its probe stops reporting. Statuses never updated are aged from when they were loaded
+func (m *Monitor) sweepStale(now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for id, ttl := range statusTTLs(m.statuses, m.probeIntervals) {
+		path, err := findStatusPath(id, m.statuses)
+		if err != nil {
+			continue
+		}
+		s := path[len(path)-1]
+		updated := s.updated
+		if updated.IsZero() {
+			updated = m.loaded
+		}
+		age := now.Sub(updated)
+		if s.Stale || age < ttl {
+			continue
+		}
+		err = m.markStale(path, id, age, now)
+		if err != nil {
+			logger.Error("Could not show stale status", "id", id, "error", err)
+		}
+	}
+}
+
+// markStale sets the last status of the path to unknown and sends it to the display. Must be called with the lock held
+func (m *Monitor) markStale(path []*Status, id string, age time.Duration, now time.Time) error {
+	s := path[len(path)-1]
+	old := s.Status
+	s.Status = StatusUnknown
+	s.Stale = true
+	s.Message = fmt.Sprintf("No update for %s", formatAge(age))
+	logger.Info("Status is stale", "id", id, "age", formatAge(age))
+	if old != s.Status {
+		m.recordTransition(id, old, s.Status, staleSource, now)
+		m.notify(path, id, old, staleSource, now)
+	}
+	err := m.display.Send(StatusUpdate{
+		ID:      id,
+		Status:  s.Status,
+		Source:  staleSource,
+		Message: s.Message,
+		Stale:   true,
+		Age:     formatAge(age),
+	})
+	if err != nil {
+		return err
+	}
+	return m.updateRollups(path[:len(path)-1], now)
+}
+
+// formatAge formats how long ago a status was updated like 1m30s
+func formatAge(age time.Duration) string {
+	return age.Round(time.Second).String()
+}
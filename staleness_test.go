@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Staleness", func() {
+	Describe("Given statuses of probes", func() {
+		Context("When their ttls are found", func() {
+			It("Then the ttl should default to a few probe intervals", func() {
+				intervals := probeIntervals([]ProbeDef{
+					{ID: "http", Type: HTTPType, Data: map[string]string{ProbeIntervalKey: "30s"}},
+					{ID: "push", Type: HTTPType},
+				})
+				Expect(intervals).To(Equal(map[string]time.Duration{"http": 30 * time.Second}))
+				ttls := statusTTLs([]*Status{
+					{ID: "prod", Rollup: &Rollup{Mode: RollupWorst}, Probe: ProbeRef{RefID: "http"}, Children: []*Status{
+						{ID: "web", Probe: ProbeRef{RefID: "http"}},
+						{ID: "api", TTL: "5m", Probe: ProbeRef{RefID: "http"}},
+						{ID: "db", TTL: "0s", Probe: ProbeRef{RefID: "http"}},
+						{ID: "cron", Probe: ProbeRef{RefID: "push"}},
+						{ID: "batch", TTL: "1h"},
+					}},
+				}, intervals)
+				Expect(ttls).To(Equal(map[string]time.Duration{
+					"prod#web":   90 * time.Second,
+					"prod#api":   5 * time.Minute,
+					"prod#batch": time.Hour,
+				}))
+			})
+		})
+	})
+
+	Describe("Given a Monitor with a status which has a ttl", func() {
+		var web *Status
+		var m *Monitor
+
+		BeforeEach(func() {
+			web = &Status{ID: "web", TTL: "1m"}
+			m = NewMonitor(&MonitorConfig{
+				Router:   mux.NewRouter(),
+				Statuses: []*Status{{ID: "prod", Rollup: &Rollup{Mode: RollupWorst}, Children: []*Status{web, {ID: "api", Status: StatusGood}}}},
+			})
+			Expect(m.UpdateStatusByID(StatusUpdate{ID: "prod#web", Status: StatusGood, Source: "http"})).To(Succeed())
+		})
+		AfterEach(func() {
+			m.Close()
+		})
+
+		Context("When the status is updated within the ttl", func() {
+			It("Then it should not be stale", func() {
+				m.sweepStale(time.Now().Add(30 * time.Second))
+				Expect(web.Status).To(Equal(StatusGood))
+				Expect(web.Stale).To(BeFalse())
+			})
+		})
+		Context("When the status is not updated within the ttl", func() {
+			It("Then it and its parent should be unknown until it is updated again", func() {
+				m.sweepStale(time.Now().Add(2 * time.Minute))
+				Expect(web.Status).To(Equal(StatusUnknown))
+				Expect(web.Stale).To(BeTrue())
+				Expect(web.Message).To(Equal("No update for 2m0s"))
+				Expect(m.statuses[0].Status).To(Equal(StatusUnknown))
+				transitions, err := m.history.Query("prod#web", time.Time{}, time.Now().Add(time.Hour))
+				Expect(err).To(BeNil())
+				Expect(transitions[len(transitions)-1].Source).To(Equal(staleSource))
+
+				Expect(m.UpdateStatusByID(StatusUpdate{ID: "prod#web", Status: StatusGood, Source: "http"})).To(Succeed())
+				Expect(web.Status).To(Equal(StatusGood))
+				Expect(web.Stale).To(BeFalse())
+				Expect(web.Message).To(BeEmpty())
+				Expect(m.statuses[0].Status).To(Equal(StatusGood))
+			})
+		})
+		Context("When the status is shown", func() {
+			It("Then it should have when it was last updated and how long ago", func() {
+				payload, err := json.Marshal(web)
+				Expect(err).To(BeNil())
+				var shown map[string]interface{}
+				Expect(json.Unmarshal(payload, &shown)).To(Succeed())
+				Expect(shown).To(HaveKeyWithValue("lastUpdated", web.updated.Format(time.RFC3339Nano)))
+				Expect(shown).To(HaveKeyWithValue("age", "0s"))
+
+				// roll-ups are never updated themselves
+				payload, err = json.Marshal(m.statuses[0])
+				Expect(err).To(BeNil())
+				shown = nil
+				Expect(json.Unmarshal(payload, &shown)).To(Succeed())
+				Expect(shown).ToNot(HaveKey("lastUpdated"))
+			})
+		})
+	})
+
+	Describe("Given a config with an invalid ttl", func() {
+		Context("When it is validated", func() {
+			It("Then it should be a problem", func() {
+				err := validateConfiguration(Configuration{Statuses: []*Status{{ID: "web", TTL: "-1m"}}})
+				Expect(err).To(BeAssignableToTypeOf(ConfigError{}))
+				Expect(err.(ConfigError).Problems).To(Equal([]ConfigProblem{{"statuses[0].ttl", "invalid duration '-1m'"}}))
+			})
+		})
+	})
+})
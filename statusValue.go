@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// StatusValue is the value of a status: good, bad, degraded or unknown.
+// StatusNone is the value of a status which has not been set yet like parents or statuses without a probe
+type StatusValue string
+
+const (
+	StatusNone     StatusValue = ""
+	StatusGood     StatusValue = monitorGood
+	StatusBad      StatusValue = monitorBad
+	StatusDegraded StatusValue = monitorDegraded
+	StatusUnknown  StatusValue = monitorUnknown
+)
+
+// statusSeverity orders the status values from least to most severe
+var statusSeverity = map[StatusValue]int{
+	StatusNone:     0,
+	StatusGood:     1,
+	StatusUnknown:  2,
+	StatusDegraded: 3,
+	StatusBad:      4,
+}
+
+// InvalidStatusError is returned when a value is not one of the valid statuses
+type InvalidStatusError struct {
+	Value string
+}
+
+func (e InvalidStatusError) Error() string {
+	return fmt.Sprintf("Invalid status '%s'. Must be one of: %s", e.Value, strings.Join(validStatuses, ", "))
+}
+
+// ParseStatusValue parses one of good, bad, degraded or unknown ignoring case and surrounding spaces
+func ParseStatusValue(value string) (StatusValue, error) {
+	sv := StatusValue(strings.ToLower(strings.TrimSpace(value)))
+	if !sv.IsValid() {
+		return StatusNone, InvalidStatusError{Value: value}
+	}
+	return sv, nil
+}
+
+// IsValid returns whether the value is one the dashboard can show. StatusNone is not valid
+func (sv StatusValue) IsValid() bool {
+	return isValidStatus(string(sv))
+}
+
+// Severity returns how severe the status is. Higher is worse: bad > degraded > unknown > good > none
+func (sv StatusValue) Severity() int {
+	return statusSeverity[sv]
+}
+
+// WorseThan returns whether the status is more severe than the other status
+func (sv StatusValue) WorseThan(other StatusValue) bool {
+	return sv.Severity() > other.Severity()
+}
+
+// MarshalJSON marshals the status as its string value
+func (sv StatusValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(sv))
+}
+
+// UnmarshalJSON only accepts valid statuses or an empty string for a status that has not been set
+func (sv *StatusValue) UnmarshalJSON(b []byte) error {
+	var value string
+	err := json.Unmarshal(b, &value)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		*sv = StatusNone
+		return nil
+	}
+	parsed, err := ParseStatusValue(value)
+	if err != nil {
+		return err
+	}
+	*sv = parsed
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StatusValue", func() {
+	Describe("Given a status string", func() {
+		Context("When it is a valid status", func() {
+			It("Then it should be parsed", func() {
+				sv, err := ParseStatusValue(" Degraded")
+				Expect(err).To(BeNil())
+				Expect(sv).To(Equal(StatusDegraded))
+			})
+		})
+		Context("When it is not a valid status", func() {
+			It("Then it should error", func() {
+				_, err := ParseStatusValue("banana")
+				Expect(err).To(MatchError(InvalidStatusError{Value: "banana"}))
+				_, err = ParseStatusValue("")
+				Expect(err).ToNot(BeNil())
+			})
+		})
+	})
+
+	Describe("Given status json", func() {
+		Context("When it is unmarshaled", func() {
+			It("Then only valid or empty statuses should be accepted", func() {
+				var s Status
+				Expect(json.Unmarshal([]byte(`{"id": "a", "status": "bad"}`), &s)).To(Succeed())
+				Expect(s.Status).To(Equal(StatusBad))
+				Expect(json.Unmarshal([]byte(`{"id": "a"}`), &s)).To(Succeed())
+				Expect(json.Unmarshal([]byte(`{"id": "a", "status": ""}`), &s)).To(Succeed())
+				Expect(s.Status).To(Equal(StatusNone))
+				Expect(json.Unmarshal([]byte(`{"id": "a", "status": "banana"}`), &s)).ToNot(Succeed())
+			})
+		})
+		Context("When it is marshaled", func() {
+			It("Then it should be the status string", func() {
+				b, err := json.Marshal(StatusUpdate{ID: "a", Status: StatusUnknown})
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(Equal(`{"id":"a","status":"unknown"}`))
+			})
+		})
+	})
+
+	Describe("Given two statuses", func() {
+		Context("When they are compared", func() {
+			It("Then bad > degraded > unknown > good", func() {
+				Expect(StatusBad.WorseThan(StatusDegraded)).To(BeTrue())
+				Expect(StatusDegraded.WorseThan(StatusUnknown)).To(BeTrue())
+				Expect(StatusUnknown.WorseThan(StatusGood)).To(BeTrue())
+				Expect(StatusGood.WorseThan(StatusNone)).To(BeTrue())
+				Expect(StatusGood.WorseThan(StatusBad)).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("Given an update with an invalid status", func() {
+		router := mux.NewRouter()
+		service := &Status{ID: "service", Status: StatusGood}
+		m := NewMonitor(&MonitorConfig{
+			Router:   router,
+			Statuses: []*Status{service},
+		})
+		Context("When it is pushed through the update endpoint", func() {
+			It("Then it should be rejected with a bad request", func() {
+				r := httptest.NewRequest(http.MethodGet, "/update/service/banana", nil)
+				r.SetBasicAuth("", "")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("Invalid status 'banana'"))
+				Expect(service.Status).To(Equal(StatusGood))
+			})
+		})
+		Context("When it is sent to the Monitor", func() {
+			It("Then it should be rejected", func() {
+				err := m.UpdateStatusByID(StatusUpdate{ID: "service", Status: "banana"})
+				Expect(err).To(MatchError(InvalidStatusError{Value: "banana"}))
+				Expect(service.Status).To(Equal(StatusGood))
+			})
+		})
+	})
+})
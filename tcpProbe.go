@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	TCPType           = "TCP"
+	TCPIntervalKey    = "interval"
+	TCPTimeoutKey     = "timeout"
+	TCPAddressKey     = "address"
+	defaultTCPTimeout = 5 * time.Second
+)
+
+// TCPProbeConfig is the configuration for a tcp probe
+type TCPProbeConfig struct {
+	id       string
+	update   chan StatusUpdate
+	health   chan ProbeReport
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// TCPProbe is a probe that checks a connection can be opened to an address
+type TCPProbe struct {
+	refID    string
+	update   chan StatusUpdate
+	health   chan ProbeReport
+	interval time.Duration
+	timeout  time.Duration
+	ticker   *time.Ticker
+	stopChan chan bool
+	checks   []*tcpCheck
+}
+
+// tcpCheck is a single address check belonging to a status
+type tcpCheck struct {
+	statusID string
+	address  string
+	timeout  time.Duration
+}
+
+func init() {
+	RegisterProbeFactory(ProbeFactory{
+		Type:            TCPType,
+		RequiredDefKeys: []string{TCPIntervalKey},
+		RequiredRefKeys: []string{TCPAddressKey},
+		New:             newTCPProbeFromConfig,
+	})
+}
+
+// newTCPProbeFromConfig creates and initializes a tcp probe for the probe registry
+func newTCPProbeFromConfig(config ProbeConfig, statuses []*Status) (Probe, error) {
+	var timeout time.Duration
+	if config.Data[TCPTimeoutKey] != "" {
+		var err error
+		timeout, err = time.ParseDuration(config.Data[TCPTimeoutKey])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %s", TCPTimeoutKey, err.Error())
+		}
+	}
+	tp := NewTCPProbe(&TCPProbeConfig{
+		id:       config.ID,
+		update:   config.Update,
+		health:   config.Health,
+		interval: config.Interval,
+		timeout:  timeout,
+	})
+	err := tp.Initialize(statuses)
+	if err != nil {
+		return nil, err
+	}
+	return tp, nil
+}
+
+// NewTCPProbe returns a tcp probe
+func NewTCPProbe(config *TCPProbeConfig) *TCPProbe {
+	timeout := config.timeout
+	if timeout == 0 {
+		timeout = defaultTCPTimeout
+	}
+	return &TCPProbe{
+		refID:    config.id,
+		update:   config.update,
+		health:   config.health,
+		interval: config.interval,
+		timeout:  timeout,
+		stopChan: make(chan bool),
+		checks:   []*tcpCheck{},
+	}
+}
+
+// Initialize parses through all status to find which addresses need to be checked
+func (tp *TCPProbe) Initialize(statuses []*Status) error {
+	return forEachProbeRef(tp.refID, statuses, func(fullStatusID string, s *Status) error {
+		check, err := tp.newCheck(fullStatusID, s)
+		if err != nil {
+			return err
+		}
+		tp.checks = append(tp.checks, check)
+		return nil
+	})
+}
+
+// Start begins checking all addresses at the given interval
+func (tp *TCPProbe) Start() {
+	if tp.ticker == nil {
+		logger.Debug("Starting TCP Probe", "refID", tp.refID)
+		tp.ticker = time.NewTicker(tp.interval)
+		tp.probe()
+		for {
+			select {
+			case <-tp.ticker.C:
+				tp.probe()
+			case <-tp.stopChan:
+				tp.ticker.Stop()
+				tp.ticker = nil
+				logger.Debug("Exiting TCP Probe", "refID", tp.refID)
+				return
+			}
+		}
+	}
+}
+
+// Stop stops checking addresses
+func (tp *TCPProbe) Stop() {
+	tp.stopChan <- true
+}
+
+// probe runs all checks concurrently. Addresses which cannot be connected to are reported as bad statuses
+// so the probe itself always reports healthy
+func (tp *TCPProbe) probe() {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, check := range tp.checks {
+		wg.Add(1)
+		go func(c *tcpCheck) {
+			defer wg.Done()
+			su := StatusUpdate{ID: c.statusID, Status: StatusGood, Source: tp.refID}
+			conn, err := net.DialTimeout("tcp", c.address, c.timeout)
+			if err != nil {
+				logger.Debug("TCP check failed", "refID", tp.refID, "address", c.address, "error", err)
+				su.Status = StatusBad
+				su.Message = err.Error()
+			} else {
+				su.Message = "connected to " + c.address
+				conn.Close()
+			}
+			tp.update <- su
+		}(check)
+	}
+	wg.Wait()
+	reportProbeHealth(tp.health, tp.refID, start, nil)
+}
+
+func (tp *TCPProbe) newCheck(fullStatusID string, s *Status) (*tcpCheck, error) {
+	data := s.Probe.Data
+	if data[TCPAddressKey] == "" {
+		return nil, fmt.Errorf("%s is missing '%s' field in 'data' for TCP probe", s.FullName, TCPAddressKey)
+	}
+	if _, _, err := net.SplitHostPort(data[TCPAddressKey]); err != nil {
+		return nil, fmt.Errorf("%s has invalid '%s' for TCP probe: %s", s.FullName, TCPAddressKey, err.Error())
+	}
+
+	timeout := tp.timeout
+	if data[TCPTimeoutKey] != "" {
+		var err error
+		timeout, err = time.ParseDuration(data[TCPTimeoutKey])
+		if err != nil {
+			return nil, fmt.Errorf("%s has invalid '%s' for TCP probe: %s", s.FullName, TCPTimeoutKey, err.Error())
+		}
+	}
+	return &tcpCheck{
+		statusID: fullStatusID,
+		address:  data[TCPAddressKey],
+		timeout:  timeout,
+	}, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TCPProbe", func() {
+	var listener net.Listener
+	var update chan StatusUpdate
+
+	BeforeEach(func() {
+		update = make(chan StatusUpdate, 10)
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	newProbe := func(data map[string]string) *TCPProbe {
+		tp := NewTCPProbe(&TCPProbeConfig{
+			id:       "tcp",
+			update:   update,
+			interval: time.Minute,
+		})
+		err := tp.Initialize([]*Status{{
+			ID: "env",
+			Children: []*Status{{
+				ID:    "database",
+				Probe: ProbeRef{RefID: "tcp", Data: data},
+			}},
+		}})
+		Expect(err).To(BeNil())
+		return tp
+	}
+
+	Describe("Given a status referencing a TCP probe", func() {
+		Context("When something is listening on the address", func() {
+			It("Then the status should be good", func() {
+				newProbe(map[string]string{TCPAddressKey: listener.Addr().String()}).probe()
+				Expect(<-update).To(Equal(StatusUpdate{ID: "env#database", Status: StatusGood, Source: "tcp", Message: "connected to " + listener.Addr().String()}))
+			})
+		})
+		Context("When nothing is listening on the address", func() {
+			It("Then the status should be bad", func() {
+				address := listener.Addr().String()
+				listener.Close()
+				newProbe(map[string]string{TCPAddressKey: address, TCPTimeoutKey: "1s"}).probe()
+				su := <-update
+				Expect(su.Status).To(Equal(StatusBad))
+				Expect(su.Message).To(ContainSubstring("refused"))
+			})
+		})
+		Context("When the address can be connected to again", func() {
+			It("Then the message of the failure should be replaced", func() {
+				m := NewMonitor(&MonitorConfig{Router: mux.NewRouter(), Statuses: []*Status{{ID: "env", Children: []*Status{{ID: "database"}}}}})
+				defer m.Close()
+				closed, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).To(BeNil())
+				closed.Close()
+				newProbe(map[string]string{TCPAddressKey: closed.Addr().String(), TCPTimeoutKey: "1s"}).probe()
+				Expect(m.UpdateStatusByID(<-update)).To(Succeed())
+				newProbe(map[string]string{TCPAddressKey: listener.Addr().String()}).probe()
+				Expect(m.UpdateStatusByID(<-update)).To(Succeed())
+				s, err := FindStatus("env#database", m.statuses)
+				Expect(err).To(BeNil())
+				Expect(s.Status).To(Equal(StatusGood))
+				Expect(s.Message).To(Equal("connected to " + listener.Addr().String()))
+			})
+		})
+		Context("When the probe data is invalid", func() {
+			It("Then it should error on initialize", func() {
+				statuses := func(data map[string]string) []*Status {
+					return []*Status{{ID: "database", Probe: ProbeRef{RefID: "tcp", Data: data}}}
+				}
+				tp := NewTCPProbe(&TCPProbeConfig{id: "tcp"})
+				Expect(tp.Initialize(statuses(map[string]string{}))).ToNot(BeNil())
+				Expect(tp.Initialize(statuses(map[string]string{TCPAddressKey: "localhost"}))).ToNot(BeNil())
+				Expect(tp.Initialize(statuses(map[string]string{TCPAddressKey: "localhost:5432", TCPTimeoutKey: "soon"}))).ToNot(BeNil())
+			})
+		})
+	})
+})
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	TLSCertType            = "TLSCert"
+	TLSCertIntervalKey     = "interval"
+	TLSCertTimeoutKey      = "timeout"
+	TLSCertWarnDaysKey     = "warnDays"
+	TLSCertCAFileKey       = "caFile"
+	TLSCertAddressKey      = "address"
+	TLSCertServerNameKey   = "serverName"
+	defaultTLSCertTimeout  = 10 * time.Second
+	defaultTLSCertWarnDays = 30
+)
+
+// TLSCertProbeConfig is the configuration for a tls certificate probe
+type TLSCertProbeConfig struct {
+	id       string
+	update   chan StatusUpdate
+	health   chan ProbeReport
+	interval time.Duration
+	timeout  time.Duration
+	warnDays int
+	rootCAs  *x509.CertPool // the system roots if nil
+}
+
+// TLSCertProbe is a probe that checks the certificate of a tls server is trusted and not about to expire
+type TLSCertProbe struct {
+	refID    string
+	update   chan StatusUpdate
+	health   chan ProbeReport
+	interval time.Duration
+	timeout  time.Duration
+	warnDays int
+	rootCAs  *x509.CertPool
+	ticker   *time.Ticker
+	stopChan chan bool
+	checks   []*tlsCertCheck
+}
+
+// tlsCertCheck is a single address check belonging to a status
+type tlsCertCheck struct {
+	statusID   string
+	address    string
+	serverName string
+	warnDays   int
+}
+
+func init() {
+	RegisterProbeFactory(ProbeFactory{
+		Type:            TLSCertType,
+		RequiredDefKeys: []string{TLSCertIntervalKey},
+		RequiredRefKeys: []string{TLSCertAddressKey},
+		New:             newTLSCertProbeFromConfig,
+	})
+}
+
+// newTLSCertProbeFromConfig creates and initializes a tls certificate probe for the probe registry
+func newTLSCertProbeFromConfig(config ProbeConfig, statuses []*Status) (Probe, error) {
+	var err error
+	var timeout time.Duration
+	if config.Data[TLSCertTimeoutKey] != "" {
+		timeout, err = time.ParseDuration(config.Data[TLSCertTimeoutKey])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %s", TLSCertTimeoutKey, err.Error())
+		}
+	}
+	warnDays := defaultTLSCertWarnDays
+	if config.Data[TLSCertWarnDaysKey] != "" {
+		warnDays, err = parseWarnDays(config.Data[TLSCertWarnDaysKey])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %s", TLSCertWarnDaysKey, err.Error())
+		}
+	}
+	var rootCAs *x509.CertPool
+	if config.Data[TLSCertCAFileKey] != "" {
+		rootCAs, err = loadCertPool(config.Data[TLSCertCAFileKey])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %s", TLSCertCAFileKey, err.Error())
+		}
+	}
+	tp := NewTLSCertProbe(&TLSCertProbeConfig{
+		id:       config.ID,
+		update:   config.Update,
+		health:   config.Health,
+		interval: config.Interval,
+		timeout:  timeout,
+		warnDays: warnDays,
+		rootCAs:  rootCAs,
+	})
+	err = tp.Initialize(statuses)
+	if err != nil {
+		return nil, err
+	}
+	return tp, nil
+}
+
+// NewTLSCertProbe returns a tls certificate probe
+func NewTLSCertProbe(config *TLSCertProbeConfig) *TLSCertProbe {
+	timeout := config.timeout
+	if timeout == 0 {
+		timeout = defaultTLSCertTimeout
+	}
+	return &TLSCertProbe{
+		refID:    config.id,
+		update:   config.update,
+		health:   config.health,
+		interval: config.interval,
+		timeout:  timeout,
+		warnDays: config.warnDays,
+		rootCAs:  config.rootCAs,
+		stopChan: make(chan bool),
+		checks:   []*tlsCertCheck{},
+	}
+}
+
+// Initialize parses through all status to find which certificates need to be checked
+func (tp *TLSCertProbe) Initialize(statuses []*Status) error {
+	return forEachProbeRef(tp.refID, statuses, func(fullStatusID string, s *Status) error {
+		check, err := tp.newCheck(fullStatusID, s)
+		if err != nil {
+			return err
+		}
+		tp.checks = append(tp.checks, check)
+		return nil
+	})
+}
+
+// Start begins checking all certificates at the given interval
+func (tp *TLSCertProbe) Start() {
+	if tp.ticker == nil {
+		logger.Debug("Starting TLS Certificate Probe", "refID", tp.refID)
+		tp.ticker = time.NewTicker(tp.interval)
+		tp.probe()
+		for {
+			select {
+			case <-tp.ticker.C:
+				tp.probe()
+			case <-tp.stopChan:
+				tp.ticker.Stop()
+				tp.ticker = nil
+				logger.Debug("Exiting TLS Certificate Probe", "refID", tp.refID)
+				return
+			}
+		}
+	}
+}
+
+// Stop stops checking certificates
+func (tp *TLSCertProbe) Stop() {
+	tp.stopChan <- true
+}
+
+// probe runs all checks concurrently. Certificates which cannot be verified are reported as bad statuses
+// so the probe itself always reports healthy
+func (tp *TLSCertProbe) probe() {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, check := range tp.checks {
+		wg.Add(1)
+		go func(c *tlsCertCheck) {
+			defer wg.Done()
+			status, message := tp.runCheck(c, time.Now())
+			tp.update <- StatusUpdate{
+				ID:      c.statusID,
+				Status:  status,
+				Source:  tp.refID,
+				Message: message,
+			}
+		}(check)
+	}
+	wg.Wait()
+	reportProbeHealth(tp.health, tp.refID, start, nil)
+}
+
+// runCheck does a handshake and returns bad if it fails, which includes expired certificates and untrusted chains,
+// and degraded if the certificate expires within the warning days
+func (tp *TLSCertProbe) runCheck(c *tlsCertCheck, now time.Time) (StatusValue, string) {
+	dialer := &net.Dialer{Timeout: tp.timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", c.address, &tls.Config{
+		ServerName: c.serverName,
+		RootCAs:    tp.rootCAs,
+	})
+	if err != nil {
+		logger.Debug("TLS certificate check failed", "refID", tp.refID, "address", c.address, "error", err)
+		return StatusBad, err.Error()
+	}
+	defer conn.Close()
+
+	expiry := chainsExpiry(conn.ConnectionState().VerifiedChains)
+	daysLeft := int(math.Floor(expiry.Sub(now).Hours() / 24))
+	message := fmt.Sprintf("certificate expires in %d days on %s", daysLeft, expiry.UTC().Format("2006-01-02"))
+	if daysLeft < c.warnDays {
+		return StatusDegraded, message
+	}
+	return StatusGood, message
+}
+
+// chainsExpiry returns when the last of the verified chains expires. A chain expires when the first certificate in it
+// does and the certificate stays trusted while any chain is valid, like a cross-signed one with a newer root
+func chainsExpiry(chains [][]*x509.Certificate) time.Time {
+	var expiry time.Time
+	for _, chain := range chains {
+		var chainExpiry time.Time
+		for _, cert := range chain {
+			if chainExpiry.IsZero() || cert.NotAfter.Before(chainExpiry) {
+				chainExpiry = cert.NotAfter
+			}
+		}
+		if chainExpiry.After(expiry) {
+			expiry = chainExpiry
+		}
+	}
+	return expiry
+}
+
+func (tp *TLSCertProbe) newCheck(fullStatusID string, s *Status) (*tlsCertCheck, error) {
+	data := s.Probe.Data
+	if data[TLSCertAddressKey] == "" {
+		return nil, fmt.Errorf("%s is missing '%s' field in 'data' for TLSCert probe", s.FullName, TLSCertAddressKey)
+	}
+	host, _, err := net.SplitHostPort(data[TLSCertAddressKey])
+	if err != nil {
+		return nil, fmt.Errorf("%s has invalid '%s' for TLSCert probe: %s", s.FullName, TLSCertAddressKey, err.Error())
+	}
+
+	serverName := data[TLSCertServerNameKey]
+	if serverName == "" {
+		serverName = host
+	}
+	warnDays := tp.warnDays
+	if data[TLSCertWarnDaysKey] != "" {
+		warnDays, err = parseWarnDays(data[TLSCertWarnDaysKey])
+		if err != nil {
+			return nil, fmt.Errorf("%s has invalid '%s' for TLSCert probe: %s", s.FullName, TLSCertWarnDaysKey, err.Error())
+		}
+	}
+	return &tlsCertCheck{
+		statusID:   fullStatusID,
+		address:    data[TLSCertAddressKey],
+		serverName: serverName,
+		warnDays:   warnDays,
+	}, nil
+}
+
+func parseWarnDays(value string) (int, error) {
+	days, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if days < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return days, nil
+}
+
+// loadCertPool reads the PEM encoded certificates of a private certificate authority
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testCert is a generated certificate along with its key
+type testCert struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate for 127.0.0.1 valid between the times. It is self-signed if parent is nil
+func newTestCert(parent *testCert, isCA bool, notBefore, notAfter time.Time) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(BeNil())
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	Expect(err).To(BeNil())
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "monitor-dashboard test"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	Expect(err).To(BeNil())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).To(BeNil())
+	return &testCert{cert: cert, der: der, key: key}
+}
+
+var _ = Describe("TLSCertProbe", func() {
+	var ca *testCert
+	var pool *x509.CertPool
+	var update chan StatusUpdate
+	var listeners []net.Listener
+	now := time.Now()
+
+	BeforeEach(func() {
+		update = make(chan StatusUpdate, 10)
+		listeners = []net.Listener{}
+		ca = newTestCert(nil, true, now.Add(-time.Hour), now.Add(365*24*time.Hour))
+		pool = x509.NewCertPool()
+		pool.AddCert(ca.cert)
+	})
+
+	AfterEach(func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	})
+
+	// serve starts a tls server with the certificate and returns its address
+	serve := func(leaf *testCert) string {
+		chain := [][]byte{leaf.der}
+		if leaf != ca {
+			chain = append(chain, ca.der)
+		}
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: chain, PrivateKey: leaf.key}},
+		})
+		Expect(err).To(BeNil())
+		listeners = append(listeners, listener)
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}
+		}()
+		return listener.Addr().String()
+	}
+
+	newProbe := func(address string) *TLSCertProbe {
+		tp := NewTLSCertProbe(&TLSCertProbeConfig{
+			id:       "tls",
+			update:   update,
+			interval: time.Minute,
+			warnDays: 30,
+			rootCAs:  pool,
+		})
+		err := tp.Initialize([]*Status{{
+			ID:    "broker",
+			Probe: ProbeRef{RefID: "tls", Data: map[string]string{TLSCertAddressKey: address}},
+		}})
+		Expect(err).To(BeNil())
+		return tp
+	}
+
+	Describe("Given a status referencing a TLSCert probe", func() {
+		Context("When the certificate is trusted and far from expiring", func() {
+			It("Then the status should be good", func() {
+				leaf := newTestCert(ca, false, now.Add(-time.Hour), now.Add(90*24*time.Hour+time.Hour))
+				newProbe(serve(leaf)).probe()
+				su := <-update
+				Expect(su.Status).To(Equal(StatusGood))
+				Expect(su.Message).To(HavePrefix("certificate expires in 90 days on"))
+			})
+		})
+		Context("When the certificate expires within the warning days", func() {
+			It("Then the status should be degraded", func() {
+				leaf := newTestCert(ca, false, now.Add(-time.Hour), now.Add(10*24*time.Hour+time.Hour))
+				newProbe(serve(leaf)).probe()
+				su := <-update
+				Expect(su.Status).To(Equal(StatusDegraded))
+				Expect(su.Message).To(HavePrefix("certificate expires in 10 days on"))
+			})
+		})
+		Context("When the certificate has expired", func() {
+			It("Then the status should be bad", func() {
+				leaf := newTestCert(ca, false, now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+				newProbe(serve(leaf)).probe()
+				su := <-update
+				Expect(su.Status).To(Equal(StatusBad))
+				Expect(su.Message).To(ContainSubstring("expired"))
+			})
+		})
+		Context("When the certificate is not signed by a trusted authority", func() {
+			It("Then the status should be bad", func() {
+				untrusted := newTestCert(nil, true, now.Add(-time.Hour), now.Add(90*24*time.Hour))
+				newProbe(serve(untrusted)).probe()
+				su := <-update
+				Expect(su.Status).To(Equal(StatusBad))
+				Expect(su.Message).To(ContainSubstring("unknown authority"))
+			})
+		})
+	})
+
+	Describe("Given a certificate verified by two chains", func() {
+		Context("When one chain expires before the other", func() {
+			It("Then the certificate should expire with the chain lasting longer", func() {
+				oldRoot := newTestCert(nil, true, now.Add(-time.Hour), now.Add(10*24*time.Hour))
+				leaf := newTestCert(ca, false, now.Add(-time.Hour), now.Add(90*24*time.Hour))
+				expiry := chainsExpiry([][]*x509.Certificate{
+					{leaf.cert, oldRoot.cert},
+					{leaf.cert, ca.cert},
+				})
+				Expect(expiry).To(Equal(leaf.cert.NotAfter))
+			})
+		})
+	})
+
+	Describe("Given a config with a TLSCert probe and a private certificate authority", func() {
+		Context("When the probe is created", func() {
+			It("Then the certificate authority should be trusted", func() {
+				dir, err := ioutil.TempDir("", "tlscert")
+				Expect(err).To(BeNil())
+				defer os.RemoveAll(dir)
+				caFile := filepath.Join(dir, "ca.pem")
+				Expect(ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.der}), 0600)).To(Succeed())
+
+				leaf := newTestCert(ca, false, now.Add(-time.Hour), now.Add(90*24*time.Hour))
+				statuses := []*Status{{ID: "broker", Probe: ProbeRef{RefID: "tls", Data: map[string]string{TLSCertAddressKey: serve(leaf), TLSCertWarnDaysKey: "100"}}}}
+				probes, err := CreateProbes([]ProbeDef{{ID: "tls", Type: TLSCertType, Data: map[string]string{TLSCertIntervalKey: "1h", TLSCertCAFileKey: caFile}}}, statuses, update, nil)
+				Expect(err).To(BeNil())
+				probes[0].(*TLSCertProbe).probe()
+				Expect((<-update).Status).To(Equal(StatusDegraded))
+
+				_, err = CreateProbes([]ProbeDef{{ID: "tls", Type: TLSCertType, Data: map[string]string{TLSCertIntervalKey: "1h", TLSCertCAFileKey: filepath.Join(dir, "missing.pem")}}}, statuses, update, nil)
+				Expect(err).ToNot(BeNil())
+			})
+		})
+	})
+})
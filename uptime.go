@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultUptimeWindow   = 30 * 24 * time.Hour
+	uptimeRefreshInterval = time.Minute
+)
+
+var (
+	EmptyUptimeWindow = errors.New("Uptime window must not be empty")
+)
+
+// Uptime is how long a status spent in each state over a window computed from its history.
+// Only the time covered by the history and with a status is counted, so percentages are of that time
+type Uptime struct {
+	ID           string                  `json:"id"`
+	Since        time.Time               `json:"since"`
+	Until        time.Time               `json:"until"`
+	Uptime       float64                 `json:"uptime"`       // percent of the window good
+	Availability float64                 `json:"availability"` // percent of the window good or degraded
+	TimeInState  map[StatusValue]float64 `json:"timeInState"`  // percent of the window in each state
+}
+
+// Uptime computes the uptime of a status between since and until. Until is capped at now
+func (m *Monitor) Uptime(id string, since, until time.Time) (Uptime, error) {
+	now := time.Now()
+	if until.After(now) {
+		until = now
+	}
+	if !until.After(since) {
+		return Uptime{}, EmptyUptimeWindow
+	}
+
+	m.lock.RLock()
+	s, err := FindStatus(id, m.statuses)
+	var current StatusValue
+	if err == nil {
+		current = s.Status
+	}
+	m.lock.RUnlock()
+	if err != nil {
+		return Uptime{}, err
+	}
+
+	transitions, err := m.history.Query(id, time.Time{}, until)
+	if err != nil {
+		return Uptime{}, err
+	}
+	return computeUptime(id, current, transitions, since, until, m.started), nil
+}
+
+// computeUptime adds up the time spent in each state using the transitions up to until sorted oldest first.
+// The history covers the time from the first transition, or from started if there are none as the status has not
+// changed since. Time before that or without a status is left out
+func computeUptime(id string, current StatusValue, transitions []Transition, since, until, started time.Time) Uptime {
+	state := current
+	if len(transitions) > 0 {
+		started = transitions[0].Timestamp
+	}
+	cursor := since
+	if started.After(cursor) {
+		cursor = started
+	}
+	durations := map[StatusValue]time.Duration{}
+	for _, t := range transitions {
+		if !t.Timestamp.After(cursor) {
+			state = t.New
+			continue
+		}
+		durations[state] += t.Timestamp.Sub(cursor)
+		cursor = t.Timestamp
+		state = t.New
+	}
+	if until.After(cursor) {
+		durations[state] += until.Sub(cursor)
+	}
+
+	var window time.Duration
+	for sv, d := range durations {
+		if sv != StatusNone {
+			window += d
+		}
+	}
+	timeInState := map[StatusValue]float64{}
+	for _, sv := range []StatusValue{StatusGood, StatusDegraded, StatusBad, StatusUnknown} {
+		timeInState[sv] = percentOf(durations[sv], window)
+	}
+	return Uptime{
+		ID:           id,
+		Since:        since,
+		Until:        until,
+		Uptime:       timeInState[StatusGood],
+		Availability: percentOf(durations[StatusGood]+durations[StatusDegraded], window),
+		TimeInState:  timeInState,
+	}
+}
+
+// percentOf returns the percent of the window. An empty window is 0
+func percentOf(d, window time.Duration) float64 {
+	if window == 0 {
+		return 0
+	}
+	return 100 * float64(d) / float64(window)
+}
+
+// formatUptime formats the uptime to be shown as sub-text on a box
+func formatUptime(u Uptime) string {
+	return fmt.Sprintf("%.2f%%", u.Uptime)
+}
+
+// uptimeRefresher periodically shows the uptime as the sub-text of statuses with showUptime set.
+// The statuses are looked up every time as they can change when the config is reloaded. Runs until the monitor is closed
+func (m *Monitor) uptimeRefresher() {
+	ticker := time.NewTicker(uptimeRefreshInterval)
+	defer ticker.Stop()
+	for {
+		m.lock.RLock()
+		windows := uptimeWindows(m.statuses)
+		m.lock.RUnlock()
+		m.refreshUptimes(windows)
+		select {
+		case <-ticker.C:
+		case <-m.closed:
+			return
+		}
+	}
+}
+
+// refreshUptimes computes the uptime of each status over its window and sends any change in sub-text to the display
+func (m *Monitor) refreshUptimes(windows map[string]time.Duration) {
+	for id, window := range windows {
+		now := time.Now()
+		u, err := m.Uptime(id, now.Add(-window), now)
+		if err != nil {
+			logger.Error("Could not compute uptime", "id", id, "error", err)
+			continue
+		}
+		subText := formatUptime(u)
+
+		m.lock.Lock()
+		s, err := FindStatus(id, m.statuses)
+		if err == nil && s.SubText != subText {
+			s.SubText = subText
+			err = m.display.Send(StatusUpdate{ID: id, Status: s.Status, SubText: subText, Stale: s.Stale})
+		}
+		m.lock.Unlock()
+		if err != nil {
+			logger.Error("Could not show uptime", "id", id, "error", err)
+		}
+	}
+}
+
+// uptimeWindows finds the statuses which show their uptime as sub-text along with the window to compute it over
+func uptimeWindows(statuses []*Status) map[string]time.Duration {
+	windows := map[string]time.Duration{}
+	forEachStatus(statuses, "", func(fullStatusID string, s *Status) error {
+		if s.ShowUptime == "" {
+			return nil
+		}
+		window, err := time.ParseDuration(s.ShowUptime)
+		if err != nil || window <= 0 {
+			logger.Error("Invalid showUptime, uptime will not be shown", "id", fullStatusID, "showUptime", s.ShowUptime)
+			return nil
+		}
+		windows[fullStatusID] = window
+		return nil
+	})
+	return windows
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Uptime", func() {
+	start := time.Date(2018, 4, 10, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time {
+		return start.Add(time.Duration(hours) * time.Hour)
+	}
+
+	Describe("Given the transitions of a status", func() {
+		transitions := []Transition{
+			{Old: StatusNone, New: StatusGood, Timestamp: at(0)},
+			{Old: StatusGood, New: StatusBad, Timestamp: at(1)},
+			{Old: StatusBad, New: StatusDegraded, Timestamp: at(2)},
+			{Old: StatusDegraded, New: StatusGood, Timestamp: at(4)},
+		}
+		Context("When the window covers all of them", func() {
+			It("Then the time in each state should be computed", func() {
+				u := computeUptime("id", StatusGood, transitions, at(0), at(10), at(0))
+				Expect(u.TimeInState[StatusGood]).To(BeNumerically("~", 70))
+				Expect(u.TimeInState[StatusBad]).To(BeNumerically("~", 10))
+				Expect(u.TimeInState[StatusDegraded]).To(BeNumerically("~", 20))
+				Expect(u.TimeInState[StatusUnknown]).To(BeNumerically("~", 0))
+				Expect(u.Uptime).To(BeNumerically("~", 70))
+				Expect(u.Availability).To(BeNumerically("~", 90))
+			})
+		})
+		Context("When the window starts after some of them", func() {
+			It("Then the state at the start of the window should be used", func() {
+				u := computeUptime("id", StatusGood, transitions, at(3), at(5), at(0))
+				Expect(u.TimeInState[StatusDegraded]).To(BeNumerically("~", 50))
+				Expect(u.TimeInState[StatusGood]).To(BeNumerically("~", 50))
+			})
+		})
+		Context("When the window starts before any of them", func() {
+			It("Then only the time from the first one should be counted", func() {
+				u := computeUptime("id", StatusBad, []Transition{
+					{Old: StatusNone, New: StatusGood, Timestamp: at(5)},
+					{Old: StatusGood, New: StatusBad, Timestamp: at(8)},
+				}, at(0), at(10), at(0))
+				Expect(u.TimeInState[StatusGood]).To(BeNumerically("~", 60))
+				Expect(u.TimeInState[StatusBad]).To(BeNumerically("~", 40))
+				Expect(u.TimeInState[StatusUnknown]).To(BeNumerically("~", 0))
+			})
+		})
+		Context("When there are no transitions", func() {
+			It("Then the current status should be used since the monitor started", func() {
+				u := computeUptime("id", StatusBad, []Transition{}, at(0), at(2), at(1))
+				Expect(u.TimeInState[StatusBad]).To(BeNumerically("~", 100))
+
+				u = computeUptime("id", StatusNone, []Transition{}, at(0), at(1), at(0))
+				Expect(u.TimeInState[StatusUnknown]).To(BeNumerically("~", 0))
+				Expect(u.Uptime).To(BeNumerically("~", 0))
+			})
+		})
+	})
+
+	Describe("Given a Monitor with history", func() {
+		var router *mux.Router
+		var m *Monitor
+		var service1 *Status
+		BeforeEach(func() {
+			router = mux.NewRouter()
+			service1 = &Status{ID: "service1", Status: StatusGood, ShowUptime: "24h"}
+			m = NewMonitor(&MonitorConfig{
+				Router:   router,
+				Statuses: []*Status{{ID: "prod", Rollup: &Rollup{Mode: RollupWorst}, Children: []*Status{service1}}},
+			})
+		})
+		AfterEach(func() {
+			m.Close()
+		})
+		request := func(method, path string, body string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			r.SetBasicAuth("", "")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			return w
+		}
+		Context("When the uptime api is called", func() {
+			It("Then the uptime of leaves and roll-up parents should be returned", func() {
+				now := time.Now().UTC().Truncate(time.Second)
+				// service1 starts good, going unknown and back records the start of its history 3h ago
+				w := request(http.MethodPost, "/api/v1/updates", `[
+					{"id": "prod#service1", "status": "unknown", "timestamp": "`+now.Add(-3*time.Hour).Format(time.RFC3339)+`"},
+					{"id": "prod#service1", "status": "good", "timestamp": "`+now.Add(-3*time.Hour).Format(time.RFC3339)+`"},
+					{"id": "prod#service1", "status": "bad", "timestamp": "`+now.Add(-time.Hour).Format(time.RFC3339)+`"}
+				]`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+
+				// the 4h window starts before the history so only the last 3h are counted
+				for _, id := range []string{"prod#service1", "prod"} {
+					w = request(http.MethodGet, "/api/v1/status/"+url.PathEscape(id)+"/uptime?window=4h&until="+url.QueryEscape(now.Format(time.RFC3339)), "")
+					Expect(w.Code).To(Equal(http.StatusOK))
+					var u Uptime
+					Expect(json.Unmarshal(w.Body.Bytes(), &u)).To(Succeed())
+					Expect(u.Uptime).To(BeNumerically("~", 66.7, 1))
+					Expect(u.TimeInState[StatusBad]).To(BeNumerically("~", 33.3, 1))
+				}
+			})
+			It("Then invalid requests should error", func() {
+				Expect(request(http.MethodGet, "/api/v1/status/nothing/uptime", "").Code).To(Equal(http.StatusNotFound))
+				Expect(request(http.MethodGet, "/api/v1/status/prod/uptime?window=forever", "").Code).To(Equal(http.StatusBadRequest))
+				Expect(request(http.MethodGet, "/api/v1/status/prod/uptime?window=0s", "").Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+		Context("When a status shows its uptime", func() {
+			It("Then its sub-text should be the uptime", func() {
+				Expect(uptimeWindows(m.statuses)).To(Equal(map[string]time.Duration{"prod#service1": 24 * time.Hour}))
+				Eventually(func() string {
+					m.lock.RLock()
+					defer m.lock.RUnlock()
+					return service1.SubText
+				}).Should(Equal("100.00%"))
+			})
+		})
+	})
+})
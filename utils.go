@@ -14,15 +14,27 @@ const (
 	monitorUnknown  = "unknown"
 )
 
-func convertNRtoMonitor(nrString string) string {
+var validStatuses = []string{monitorGood, monitorBad, monitorDegraded, monitorUnknown}
+
+// isValidStatus returns whether the status is one the dashboard can show
+func isValidStatus(status string) bool {
+	for _, s := range validStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func convertNRtoMonitor(nrString string) StatusValue {
 	switch nrString {
 	case nrGood:
-		return monitorGood
+		return StatusGood
 	case nrBad:
-		return monitorBad
+		return StatusBad
 	default:
 		logger.Debug("Recieved unknown status from new relic", "status", nrString)
-		return monitorUnknown
+		return StatusUnknown
 	}
 }
 
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	validateCommand = "validate"
+)
+
+// typedConfigFields are status fields with their own json parsing. An invalid value fails the whole parse
+// so they are checked first to be reported with their path
+var typedConfigFields = []struct {
+	key      string
+	newValue func() interface{}
+}{
+	{"status", func() interface{} { return new(StatusValue) }},
+	{"rollup", func() interface{} { return new(Rollup) }},
+}
+
+// runValidate checks a config file and prints every problem found. Returns the exit code which is non-zero
+// if there are problems so it can gate config changes
+func runValidate(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet(validateCommand, flag.ContinueOnError)
+	flags.SetOutput(out)
+	configFile := flags.String("config", configFileFromEnv(), "config file to validate")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	problems, err := validateConfigFile(*configFile)
+	if err != nil {
+		fmt.Fprintf(out, "%s: %s\n", *configFile, err.Error())
+		return 1
+	}
+	for _, p := range problems {
+		fmt.Fprintf(out, "%s: %s\n", *configFile, p.String())
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(out, "%s: %d problem(s) found\n", *configFile, len(problems))
+		return 1
+	}
+	fmt.Fprintf(out, "%s: ok\n", *configFile)
+	return 0
+}
+
+func configFileFromEnv() string {
+	if configFile := os.Getenv("CONFIG_FILE"); configFile != "" {
+		return configFile
+	}
+	return "config.json"
+}
+
+// validateConfigFile reads the config file and returns every problem found. Invalid values that would stop
+// the config from parsing are reported and removed so the rest of the config can still be checked, as are variables
+// which cannot be interpolated. Paths are in the config after includes and templates are expanded
+func validateConfigFile(fileLocation string) ([]ConfigProblem, error) {
+	raw, _, problems, err := loadConfigFile(fileLocation, nil)
+	if err != nil {
+		return []ConfigProblem{{Message: err.Error()}}, nil
+	}
+	err = expandConfig(raw)
+	if err != nil {
+		return append(problems, ConfigProblem{Message: err.Error()}), nil
+	}
+
+	if statuses, ok := raw["statuses"].([]interface{}); ok {
+		problems = append(problems, removeInvalidValues(statuses, "statuses")...)
+	}
+	sanitized, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var config Configuration
+	err = json.Unmarshal(sanitized, &config)
+	if err != nil {
+		return append(problems, ConfigProblem{Message: err.Error()}), nil
+	}
+	return append(problems, configProblems(config)...), nil
+}
+
+// removeInvalidValues checks the typed fields of the statuses and their children and removes the invalid ones
+func removeInvalidValues(statuses []interface{}, path string) []ConfigProblem {
+	problems := []ConfigProblem{}
+	for i, value := range statuses {
+		s, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		statusPath := fmt.Sprintf("%s[%d]", path, i)
+		for _, typed := range typedConfigFields {
+			field, ok := s[typed.key]
+			if !ok {
+				continue
+			}
+			b, _ := json.Marshal(field)
+			err := json.Unmarshal(b, typed.newValue())
+			if err != nil {
+				problems = append(problems, ConfigProblem{statusPath + "." + typed.key, err.Error()})
+				delete(s, typed.key)
+			}
+		}
+		if children, ok := s["children"].([]interface{}); ok {
+			problems = append(problems, removeInvalidValues(children, statusPath+".children")...)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	SlackType              = "Slack"
+	WebhookType            = "Webhook"
+	NotifierURLKey         = "url"
+	SlackChannelKey        = "channel"
+	SlackUsernameKey       = "username"
+	WebhookBearerTokenKey  = "bearerToken"
+	maxWebhookResponseSize = 1 << 10 // only used in errors
+)
+
+// SlackNotifier posts the message of notifications to a Slack incoming webhook or any service accepting the same payload
+type SlackNotifier struct {
+	url      string
+	channel  string // overrides the channel of the webhook if set
+	username string // overrides the name of the webhook if set
+	client   *http.Client
+}
+
+// slackMessage is the payload of a Slack incoming webhook
+type slackMessage struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// WebhookNotifier posts notifications as json to a URL
+type WebhookNotifier struct {
+	url         string
+	bearerToken string
+	client      *http.Client
+}
+
+func init() {
+	RegisterNotifierFactory(NotifierFactory{
+		Type:         SlackType,
+		RequiredKeys: []string{NotifierURLKey},
+		New: func(def NotifierDef) (Notifier, error) {
+			return NewSlackNotifier(def.Data[NotifierURLKey], def.Data[SlackChannelKey], def.Data[SlackUsernameKey]), nil
+		},
+	})
+	RegisterNotifierFactory(NotifierFactory{
+		Type:         WebhookType,
+		RequiredKeys: []string{NotifierURLKey},
+		New: func(def NotifierDef) (Notifier, error) {
+			return NewWebhookNotifier(def.Data[NotifierURLKey], def.Data[WebhookBearerTokenKey]), nil
+		},
+	})
+}
+
+// NewSlackNotifier returns a Slack notifier
+func NewSlackNotifier(url, channel, username string) *SlackNotifier {
+	return &SlackNotifier{
+		url:      url,
+		channel:  channel,
+		username: username,
+		client:   &http.Client{Timeout: notifierTimeout},
+	}
+}
+
+// Notify posts the message of the notification
+func (sn *SlackNotifier) Notify(n Notification) error {
+	return postJSON(sn.client, sn.url, "", slackMessage{
+		Text:     n.Text,
+		Channel:  sn.channel,
+		Username: sn.username,
+	})
+}
+
+// NewWebhookNotifier returns a webhook notifier. The bearer token is sent in the Authorization header if set
+func NewWebhookNotifier(url, bearerToken string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:         url,
+		bearerToken: bearerToken,
+		client:      &http.Client{Timeout: notifierTimeout},
+	}
+}
+
+// Notify posts the notification
+func (wn *WebhookNotifier) Notify(n Notification) error {
+	return postJSON(wn.client, wn.url, wn.bearerToken, n)
+}
+
+// postJSON posts the body as json and returns an error with the start of the response if the status code is not 2xx
+func postJSON(client *http.Client, url, bearerToken string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseSize))
+		return fmt.Errorf("Webhook returned %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebhookNotifier", func() {
+	var server *httptest.Server
+	var requests chan *http.Request
+	var bodies chan map[string]interface{}
+	var statusCode int
+
+	notification := Notification{
+		ID:        "prod#web",
+		FullName:  "Production / Website",
+		Status:    StatusBad,
+		Previous:  StatusGood,
+		Timestamp: time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC),
+		Text:      "Production / Website is bad (was good)",
+	}
+
+	BeforeEach(func() {
+		requests = make(chan *http.Request, 1)
+		bodies = make(chan map[string]interface{}, 1)
+		statusCode = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			body := map[string]interface{}{}
+			Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+			requests <- r
+			bodies <- body
+			w.WriteHeader(statusCode)
+			w.Write([]byte("invalid_payload\n"))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Given a Slack notifier", func() {
+		Context("When a notification is sent", func() {
+			It("Then the message should be posted as a Slack message", func() {
+				Expect(NewSlackNotifier(server.URL, "#ops", "monitor").Notify(notification)).To(Succeed())
+				Expect((<-requests).Header.Get("Content-Type")).To(Equal("application/json"))
+				Expect(<-bodies).To(Equal(map[string]interface{}{
+					"text":     "Production / Website is bad (was good)",
+					"channel":  "#ops",
+					"username": "monitor",
+				}))
+			})
+		})
+		Context("When the webhook responds with an error", func() {
+			It("Then the error should have the response", func() {
+				statusCode = http.StatusBadRequest
+				Expect(NewSlackNotifier(server.URL, "", "").Notify(notification)).To(MatchError("Webhook returned 400: invalid_payload"))
+				Expect(<-bodies).To(Equal(map[string]interface{}{"text": "Production / Website is bad (was good)"}))
+			})
+		})
+	})
+
+	Describe("Given a webhook notifier", func() {
+		Context("When a notification is sent", func() {
+			It("Then the whole notification should be posted as json", func() {
+				Expect(NewWebhookNotifier(server.URL, "s3cret").Notify(notification)).To(Succeed())
+				Expect((<-requests).Header.Get("Authorization")).To(Equal("Bearer s3cret"))
+				Expect(<-bodies).To(Equal(map[string]interface{}{
+					"id":        "prod#web",
+					"fullName":  "Production / Website",
+					"status":    "bad",
+					"previous":  "good",
+					"timestamp": "2018-03-01T12:00:00Z",
+					"text":      "Production / Website is bad (was good)",
+				}))
+			})
+		})
+	})
+})
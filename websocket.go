@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"html/template"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -11,10 +12,19 @@ import (
 )
 
 const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
+	writeWait         = 10 * time.Second
+	pongWait          = 60 * time.Second
+	pingPeriod        = (pongWait * 9) / 10
+	maxMessageSize    = 512
+	clientBufferSize  = 256  // messages waiting to be written to a client before it is considered too slow
+	maxReplayMessages = 1024 // messages kept to replay to clients that resync
+
+	liveProtocolVersion    = 1
+	snapshotMessageType    = "snapshot"
+	probeHealthMessageType = "probeHealth"
+	resyncMessageType      = "resync"
+	structureMessageType   = "structureChanged"
+	flappingMessageType    = "flapping"
 )
 
 var (
@@ -28,10 +38,57 @@ var (
 )
 
 // StatusUpdate is the payload sent the to frontend for status update
+// Empty optional fields leave the current value of the status unchanged
 type StatusUpdate struct {
-	ID               string `json:"id"`
-	Status           string `json:"status"`
-	lastUpdateMillis int    `json:"lastUpdateMillis"`
+	ID               string      `json:"id"`
+	Status           StatusValue `json:"status"`
+	Source           string      `json:"source,omitempty"` // id of the probe which sent the update
+	Message          string      `json:"message,omitempty"`
+	SubText          string      `json:"subText,omitempty"`
+	URL              string      `json:"url,omitempty"`
+	Timestamp        *time.Time  `json:"timestamp,omitempty"` // updates older than the last update of the status are ignored
+	Seq              uint64      `json:"seq,omitempty"`       // set by the Display when sent to the frontend
+	Stale            bool        `json:"stale,omitempty"`     // set when the status is unknown because it was not updated within its ttl
+	Age              string      `json:"age,omitempty"`       // how long ago a stale status was last updated
+	lastUpdateMillis int
+}
+
+// ProbeHealthMessage is the payload sent to the frontend when the health of a probe changes
+type ProbeHealthMessage struct {
+	Type  string      `json:"type"`
+	Seq   uint64      `json:"seq"`
+	Probe ProbeHealth `json:"probe"`
+}
+
+// FlappingMessage is the payload sent to the frontend when a status starts or stops flapping
+type FlappingMessage struct {
+	Type     string `json:"type"`
+	Seq      uint64 `json:"seq"`
+	ID       string `json:"id"`
+	Flapping bool   `json:"flapping"`
+}
+
+// SnapshotMessage is the full state sent to the frontend when it connects or resyncs.
+// Every message after it has a seq greater than the snapshot's seq.
+// It is also sent to every client with the structureChanged type when the status tree changes
+type SnapshotMessage struct {
+	Type     string        `json:"type"`
+	Version  int           `json:"version"`
+	Seq      uint64        `json:"seq"`
+	Statuses []*Status     `json:"statuses"`
+	Probes   []ProbeHealth `json:"probes,omitempty"`
+}
+
+// clientMessage is a message sent from the frontend. A resync asks for every message after seq
+type clientMessage struct {
+	Type string `json:"type"`
+	Seq  uint64 `json:"seq"`
+}
+
+// sequencedPayload is a sent message kept for replaying
+type sequencedPayload struct {
+	seq     uint64
+	payload []byte
 }
 
 type tmpl struct {
@@ -40,10 +97,16 @@ type tmpl struct {
 	data      interface{}
 }
 
-// Display keeps track of the client to send updates
+// Display keeps track of the client to send updates.
+// Every message sent is numbered with a monotonic seq so clients can tell when they missed one
 type Display struct {
-	clients map[*client]bool
-	tmpls   []tmpl
+	lock         sync.Mutex
+	clients      map[*client]bool
+	tmpls        []tmpl
+	seq          uint64
+	recent       []sequencedPayload
+	snapshot     func() Statuses
+	snapshotLock sync.Locker // held while taking a snapshot. Always taken before lock
 }
 
 // NewDisplay returns a new display
@@ -51,6 +114,11 @@ func NewDisplay(name string) *Display {
 	d := &Display{
 		clients: map[*client]bool{},
 		tmpls:   []tmpl{},
+		recent:  []sequencedPayload{},
+		snapshot: func() Statuses {
+			return Statuses{Statuses: []*Status{}}
+		},
+		snapshotLock: &sync.Mutex{},
 	}
 	d.tmpls = append(d.tmpls, tmpl{
 		routePath: "/components/container-header/container-header.html",
@@ -66,36 +134,160 @@ func (d *Display) RouteStatic(router *mux.Router) {
 	routeStaticWebApp(router, "./public")
 }
 
-// AddClient adds a client to be sent updates
-func (d *Display) AddClient(c *client) {
+// SetSnapshotSource sets where the full state sent to clients on connect and resync comes from.
+// The snapshot is taken with snapshotLock held so it cannot change while being sent
+func (d *Display) SetSnapshotSource(snapshot func() Statuses, snapshotLock sync.Locker) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.snapshot = snapshot
+	d.snapshotLock = snapshotLock
+}
+
+// AddClient adds a client to be sent updates. The client is sent a snapshot first
+func (d *Display) AddClient(c *client) error {
+	d.snapshotLock.Lock()
+	defer d.snapshotLock.Unlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	d.clients[c] = true
+	return d.sendSnapshot(c)
 }
 
 // RemoveClient removes a client
 func (d *Display) RemoveClient(c *client) {
-	for client := range d.clients {
-		if client == c {
-			delete(d.clients, client)
-			c.close()
-		}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.clients[c] {
+		delete(d.clients, c)
+		c.close()
 	}
 }
 
+// ClientCount returns the number of connected clients
+func (d *Display) ClientCount() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.clients)
+}
+
 // Send sends status update to all connected clients
 func (d *Display) Send(su StatusUpdate) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	su.Seq = d.seq + 1
+	su.Message = secrets.redact(su.Message)
+	su.SubText = secrets.redactField(su.SubText)
+	su.URL = secrets.redactField(su.URL)
 	payload, err := json.Marshal(su)
 	if err != nil {
 		return err
 	}
+	d.broadcast(payload)
+	return nil
+}
+
+// SendProbeHealth sends the health of a probe to all connected clients
+func (d *Display) SendProbeHealth(ph ProbeHealth) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	payload, err := json.Marshal(ProbeHealthMessage{
+		Type:  probeHealthMessageType,
+		Seq:   d.seq + 1,
+		Probe: ph,
+	})
+	if err != nil {
+		return err
+	}
+	d.broadcast(payload)
+	return nil
+}
+
+// SendFlapping sends whether a status is flapping to all connected clients
+func (d *Display) SendFlapping(id string, flapping bool) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	payload, err := json.Marshal(FlappingMessage{
+		Type:     flappingMessageType,
+		Seq:      d.seq + 1,
+		ID:       id,
+		Flapping: flapping,
+	})
+	if err != nil {
+		return err
+	}
+	d.broadcast(payload)
+	return nil
+}
+
+// SendStructure sends the new status tree to all connected clients so they re-render after the config is reloaded
+func (d *Display) SendStructure(ss Statuses) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	payload, err := json.Marshal(SnapshotMessage{
+		Type:     structureMessageType,
+		Version:  liveProtocolVersion,
+		Seq:      d.seq + 1,
+		Statuses: ss.Statuses,
+		Probes:   ss.Probes,
+	})
+	if err != nil {
+		return err
+	}
+	d.broadcast(payload)
+	return nil
+}
+
+// Resync sends a client every message after seq. If those messages are no longer kept, a new snapshot is sent
+func (d *Display) Resync(c *client, seq uint64) error {
+	d.snapshotLock.Lock()
+	defer d.snapshotLock.Unlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if !d.clients[c] {
+		return nil
+	}
+	if seq > d.seq || (len(d.recent) > 0 && seq+1 < d.recent[0].seq) || (len(d.recent) == 0 && seq < d.seq) {
+		logger.Debug("Resync too far behind, sending snapshot", "seq", seq, "current seq", d.seq)
+		return d.sendSnapshot(c)
+	}
+	for _, sp := range d.recent {
+		if sp.seq > seq {
+			c.enqueue(sp.payload)
+		}
+	}
+	return nil
+}
+
+// broadcast numbers the payload with the next seq and sends it to all clients. Must be called with the lock held
+func (d *Display) broadcast(payload []byte) {
+	d.seq++
+	d.recent = append(d.recent, sequencedPayload{seq: d.seq, payload: payload})
+	if len(d.recent) > maxReplayMessages {
+		d.recent = d.recent[len(d.recent)-maxReplayMessages:]
+	}
 	for c := range d.clients {
-		go func(c *client) {
-			c.send <- payload
-		}(c)
+		c.enqueue(payload)
 	}
+}
+
+// sendSnapshot sends the full state to a client. Must be called with snapshotLock and lock held
+func (d *Display) sendSnapshot(c *client) error {
+	ss := d.snapshot()
+	payload, err := json.Marshal(SnapshotMessage{
+		Type:     snapshotMessageType,
+		Version:  liveProtocolVersion,
+		Seq:      d.seq,
+		Statuses: ss.Statuses,
+		Probes:   ss.Probes,
+	})
+	if err != nil {
+		return err
+	}
+	c.enqueue(payload)
 	return nil
 }
 
-//LiveStatus is the handler for the websocket endpoint
+// LiveStatus is the handler for the websocket endpoint
 func (d *Display) LiveStatus() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.Debug("ws client connection opened")
@@ -106,11 +298,15 @@ func (d *Display) LiveStatus() http.Handler {
 		}
 		client := &client{
 			conn:      conn,
-			send:      make(chan []byte),
+			send:      make(chan []byte, clientBufferSize),
 			heartbeat: 1 * time.Second,
 		}
-		d.AddClient(client)
+		err = d.AddClient(client)
+		if err != nil {
+			logger.Error("Could not send snapshot to ws client", "error", err)
+		}
 		go client.process(d)
+		go client.read(d)
 	})
 }
 
@@ -140,6 +336,40 @@ func (c *client) close() {
 	c.conn.Close()
 }
 
+// enqueue queues a payload to be written without blocking. If the client is too slow the payload is dropped
+// and the client will notice the gap in seq and resync
+func (c *client) enqueue(payload []byte) {
+	select {
+	case c.send <- payload:
+	default:
+		logger.Warning("ws client too slow, dropping message")
+	}
+}
+
+// read handles messages from the websocket connection like resync requests
+func (c *client) read(d *Display) {
+	defer d.RemoveClient(c)
+	c.conn.SetReadLimit(maxMessageSize)
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var cm clientMessage
+		err = json.Unmarshal(message, &cm)
+		if err != nil {
+			logger.Debug("Could not parse ws client message", "error", err)
+			continue
+		}
+		if cm.Type == resyncMessageType {
+			err = d.Resync(c, cm.Seq)
+			if err != nil {
+				logger.Error("Could not resync ws client", "error", err)
+			}
+		}
+	}
+}
+
 // process sends messages from channel to the websocket connection
 func (c *client) process(d *Display) {
 	defer func() {
@@ -153,7 +383,10 @@ func (c *client) process(d *Display) {
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
-		case payload := <-c.send:
+		case payload, ok := <-c.send:
+			if !ok {
+				return
+			}
 			err := writeToConnection(c.conn, payload)
 			if err != nil {
 				logger.Error("Could not make ws writer", "error", err)
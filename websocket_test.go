@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Display", func() {
+	var server *httptest.Server
+	var m *Monitor
+
+	BeforeEach(func() {
+		router := mux.NewRouter()
+		m = NewMonitor(&MonitorConfig{
+			Router:   router,
+			Username: "admin",
+			Password: "password",
+			Statuses: []*Status{{ID: "service1", Status: StatusGood}},
+		})
+		server = httptest.NewServer(router)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	connect := func() *websocket.Conn {
+		url := "ws://" + strings.TrimPrefix(server.URL, "http://") + "/live"
+		header := http.Header{}
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:password")))
+		conn, _, err := websocket.DefaultDialer.Dial(url, header)
+		Expect(err).To(BeNil())
+		return conn
+	}
+
+	readMessage := func(conn *websocket.Conn, v interface{}) {
+		_, payload, err := conn.ReadMessage()
+		Expect(err).To(BeNil())
+		Expect(json.Unmarshal(payload, v)).To(Succeed())
+	}
+
+	Describe("Given a websocket client", func() {
+		Context("When it connects", func() {
+			It("Then it should be sent a snapshot of all statuses", func() {
+				conn := connect()
+				defer conn.Close()
+
+				var snapshot SnapshotMessage
+				readMessage(conn, &snapshot)
+				Expect(snapshot.Type).To(Equal(snapshotMessageType))
+				Expect(snapshot.Version).To(Equal(liveProtocolVersion))
+				Expect(snapshot.Seq).To(Equal(uint64(0)))
+				Expect(snapshot.Statuses).To(HaveLen(1))
+				Expect(snapshot.Statuses[0].Status).To(Equal(StatusGood))
+			})
+		})
+		Context("When statuses change after connecting", func() {
+			It("Then the updates should have increasing seq", func() {
+				conn := connect()
+				defer conn.Close()
+				var snapshot SnapshotMessage
+				readMessage(conn, &snapshot)
+
+				Expect(m.UpdateStatusByID(StatusUpdate{ID: "service1", Status: StatusBad})).To(Succeed())
+				Expect(m.UpdateStatusByID(StatusUpdate{ID: "service1", Status: StatusDegraded})).To(Succeed())
+
+				var su StatusUpdate
+				readMessage(conn, &su)
+				Expect(su.Seq).To(Equal(snapshot.Seq + 1))
+				Expect(su.Status).To(Equal(StatusBad))
+				readMessage(conn, &su)
+				Expect(su.Seq).To(Equal(snapshot.Seq + 2))
+			})
+		})
+		Context("When a status starts flapping", func() {
+			It("Then a flapping message should be sent", func() {
+				service, err := FindStatus("service1", m.statuses)
+				Expect(err).To(BeNil())
+				service.Hysteresis = &Hysteresis{Count: 2, FlapChanges: 1, FlapWindow: "1h"}
+				conn := connect()
+				defer conn.Close()
+				var snapshot SnapshotMessage
+				readMessage(conn, &snapshot)
+
+				Expect(m.UpdateStatusByID(StatusUpdate{ID: "service1", Status: StatusBad})).To(Succeed())
+				Expect(m.UpdateStatusByID(StatusUpdate{ID: "service1", Status: StatusGood})).To(Succeed())
+				Expect(m.UpdateStatusByID(StatusUpdate{ID: "service1", Status: StatusBad})).To(Succeed())
+
+				var fm FlappingMessage
+				readMessage(conn, &fm)
+				Expect(fm).To(Equal(FlappingMessage{Type: flappingMessageType, Seq: snapshot.Seq + 1, ID: "service1", Flapping: true}))
+			})
+		})
+		Context("When it asks to resync from a seq", func() {
+			It("Then every message after that seq should be sent again", func() {
+				conn := connect()
+				defer conn.Close()
+				var snapshot SnapshotMessage
+				readMessage(conn, &snapshot)
+				Expect(m.UpdateStatusByID(StatusUpdate{ID: "service1", Status: StatusBad})).To(Succeed())
+				Expect(m.UpdateStatusByID(StatusUpdate{ID: "service1", Status: StatusDegraded})).To(Succeed())
+				var su StatusUpdate
+				readMessage(conn, &su)
+				readMessage(conn, &su)
+
+				Expect(conn.WriteJSON(clientMessage{Type: resyncMessageType, Seq: 1})).To(Succeed())
+				readMessage(conn, &su)
+				Expect(su.Seq).To(Equal(uint64(2)))
+				Expect(su.Status).To(Equal(StatusDegraded))
+			})
+		})
+		Context("When it asks to resync from a seq the server does not know", func() {
+			It("Then a new snapshot should be sent", func() {
+				conn := connect()
+				defer conn.Close()
+				var snapshot SnapshotMessage
+				readMessage(conn, &snapshot)
+
+				Expect(conn.WriteJSON(clientMessage{Type: resyncMessageType, Seq: 100})).To(Succeed())
+				readMessage(conn, &snapshot)
+				Expect(snapshot.Type).To(Equal(snapshotMessageType))
+			})
+		})
+	})
+})